@@ -0,0 +1,23 @@
+package machines
+
+import (
+	"fmt"
+)
+
+type App struct {
+	ID           string        `json:"id"`
+	Name         string        `json:"name"`
+	Status       string        `json:"status"`
+	Network      string        `json:"network"`
+	MachineCount int           `json:"machine_count"`
+	Organization *Organization `json:"organization,omitempty"`
+}
+
+type Organization struct {
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+func (a App) Inspect() string {
+	return fmt.Sprintf("app(id=%q name=%q status=%q)", a.ID, a.Name, a.Status)
+}
@@ -0,0 +1,126 @@
+package machines_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	machines "github.com/sosedoff/fly-machines"
+	"github.com/sosedoff/fly-machines/testdata"
+)
+
+func TestApps(t *testing.T) {
+	srv := testdata.Server("app")
+	defer srv.Close()
+
+	client := testClient(srv.URL)
+	ctx := context.Background()
+
+	_, err := client.CreateAppContext(ctx, nil)
+	require.Equal(t, machines.ErrInputRequired, err)
+
+	_, err = client.CreateAppContext(ctx, &machines.CreateAppInput{})
+	require.Equal(t, machines.ErrAppNameRequired, err)
+
+	_, err = client.CreateAppContext(ctx, &machines.CreateAppInput{Name: "customer-1"})
+	require.Equal(t, machines.ErrOrgSlugRequired, err)
+
+	_, err = client.ListAppsContext(ctx, &machines.ListAppsInput{})
+	require.Equal(t, machines.ErrOrgSlugRequired, err)
+
+	_, err = client.GetAppContext(ctx, &machines.AppInput{})
+	require.Equal(t, machines.ErrAppNameRequired, err)
+
+	_, err = client.GetAppContext(ctx, &machines.AppInput{Name: "missing"})
+	require.Equal(t, "app not found", err.Error())
+
+	_, err = client.CreateAppContext(ctx, &machines.CreateAppInput{Name: "app", OrgSlug: "personal"})
+	require.Equal(t, "app name is already taken", err.Error())
+
+	// Conflicts unrelated to machine leases are not reported as held leases
+	_, err = client.CreateAppContext(ctx, &machines.CreateAppInput{Name: "conflict", OrgSlug: "personal"})
+	require.ErrorIs(t, err, machines.ErrConflict)
+	require.NotErrorIs(t, err, machines.ErrLeaseHeld)
+	require.False(t, errors.As(err, &machines.LeaseHeldError{}))
+
+	app, err := client.CreateAppContext(ctx, &machines.CreateAppInput{Name: "customer-1", OrgSlug: "customers"})
+	require.NoError(t, err)
+	require.Equal(t, "customer-1", app.Name)
+	require.Equal(t, "customers", app.Organization.Slug)
+
+	apps, err := client.ListAppsContext(ctx, &machines.ListAppsInput{OrgSlug: "customers"})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(apps))
+	require.Equal(t, "customer-1", apps[0].Name)
+
+	apps, err = client.ListAppsContext(ctx, &machines.ListAppsInput{OrgSlug: "personal"})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(apps))
+	require.Equal(t, "app", apps[0].Name)
+
+	// Derived client targets the new app
+	scoped := client.WithApp(app)
+	require.Equal(t, "customer-1", scoped.GetAppName())
+	require.Equal(t, "app", client.GetAppName())
+
+	_, err = scoped.ListContext(ctx, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, client.DeleteAppContext(ctx, &machines.AppInput{Name: app.Name}))
+
+	_, err = scoped.ListContext(ctx, nil)
+	require.Equal(t, "app not found", err.Error())
+
+	err = client.DeleteAppContext(ctx, &machines.AppInput{Name: app.Name})
+	require.Equal(t, "app not found", err.Error())
+
+	// App name is escaped, so it can't address other resources
+	var path string
+	escaped := machines.NewClient("app",
+		machines.WithBaseURL(srv.URL),
+		machines.WithToken("api_token"),
+		machines.WithMiddleware(machines.Middleware{
+			BeforeRequest: func(call *machines.Call) error {
+				path = call.Request.URL.EscapedPath()
+				return nil
+			},
+		}),
+	)
+	_, _ = escaped.GetAppContext(ctx, &machines.AppInput{Name: "app/machines/1"})
+	require.Equal(t, "/v1/apps/app%2Fmachines%2F1", path)
+
+	_ = escaped.DeleteAppContext(ctx, &machines.AppInput{Name: "app/machines/1"})
+	require.Equal(t, "/v1/apps/app%2Fmachines%2F1", path)
+}
+
+func TestWithApp(t *testing.T) {
+	srv := testdata.Server("app")
+	defer srv.Close()
+
+	var path string
+	client := machines.NewClient("app",
+		machines.WithBaseURL(srv.URL),
+		machines.WithToken("api_token"),
+		machines.WithMiddleware(machines.Middleware{
+			BeforeRequest: func(call *machines.Call) error {
+				path = call.Request.URL.EscapedPath()
+				return nil
+			},
+		}),
+	)
+
+	// App name is escaped in the request path
+	_, err := client.WithApp(&machines.App{Name: "app/machines/1"}).ListContext(context.Background(), nil)
+	require.Error(t, err)
+	require.Equal(t, "/v1/apps/app%2Fmachines%2F1/machines", path)
+
+	var nilClient *machines.Client
+	require.Nil(t, nilClient.WithApp(&machines.App{Name: "app"}))
+	require.Nil(t, nilClient.WithLease(&machines.Lease{MachineID: "1"}))
+
+	unchanged := client.WithApp(nil)
+	require.NotNil(t, unchanged)
+	require.Equal(t, "app", unchanged.GetAppName())
+}
@@ -4,9 +4,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 )
 
 const (
@@ -15,113 +19,919 @@ const (
 	DefaultBaseURL = PublicBaseURL
 )
 
+const (
+	leaseNonceHeader = "fly-machine-lease-nonce"
+	requestIDHeader  = "fly-request-id"
+)
+
 type Client struct {
-	client   *http.Client
-	baseURL  string
-	apiToken string
-	appName  string
+	client      *http.Client
+	transport   http.RoundTripper
+	middlewares []TransportMiddleware
+	hooks       []Middleware
+	baseURL     string
+	apiToken    string
+	appName     string
+	userAgent   string
+	headers     http.Header
+	lease       *Lease
+	secrets     *redactor
+	retry       *RetryPolicy
+	limiter     *RateLimiter
+}
+
+// NewClient returns a client for the app. API URL and token are read from
+// FLY_API_HOSTNAME and FLY_API_TOKEN env vars unless set with options.
+func NewClient(appName string, opts ...Option) *Client {
+	client := &Client{
+		appName:   appName,
+		client:    http.DefaultClient,
+		baseURL:   envVarWithDefault("FLY_API_HOSTNAME", DefaultBaseURL),
+		apiToken:  envVarWithDefault("FLY_API_TOKEN", ""),
+		userAgent: ClientVersion(),
+		headers:   http.Header{},
+		secrets:   newRedactor(),
+	}
+
+	for _, opt := range opts {
+		opt(client)
+	}
+	client.client = client.buildHTTPClient()
+
+	return client
+}
+
+func NewClientWithToken(appName, token string, opts ...Option) *Client {
+	return NewClient(appName, append([]Option{WithToken(token)}, opts...)...)
+}
+
+func (c *Client) SetAppName(name string) {
+	c.appName = name
+}
+
+func (c *Client) GetAppName() string {
+	return c.appName
+}
+
+func (c *Client) SetToken(token string) {
+	c.apiToken = token
+}
+
+func (c *Client) SetBaseURL(url string) {
+	c.baseURL = url
+}
+
+func (c *Client) GetBaseURL() string {
+	return c.baseURL
+}
+
+// AddSecretValues registers sensitive values, such as credentials passed via
+// Config.Env, to be redacted from API errors. Values shorter than 6 characters
+// are ignored.
+func (c *Client) AddSecretValues(values ...string) {
+	c.secrets.add(values...)
+}
+
+// WithLease returns a copy of the client that sends the lease nonce with every
+// mutating request made against the leased machine. Returns nil if the client is nil.
+func (c *Client) WithLease(lease *Lease) *Client {
+	if c == nil {
+		return nil
+	}
+	leased := *c
+	leased.lease = lease
+	return &leased
+}
+
+// WithApp returns a copy of the client scoped to the app. Returns nil if the
+// client is nil, and an unchanged copy if the app is nil.
+func (c *Client) WithApp(app *App) *Client {
+	if c == nil {
+		return nil
+	}
+	scoped := *c
+	if app == nil {
+		return &scoped
+	}
+	scoped.appName = app.Name
+	scoped.lease = nil
+	return &scoped
+}
+
+// GetLease returns the lease attached to the client, if any
+func (c *Client) GetLease() *Lease {
+	return c.lease
+}
+
+func (c *Client) List(input *ListInput) ([]Machine, error) {
+	return c.ListContext(context.Background(), input)
+}
+
+func (c *Client) ListContext(ctx context.Context, input *ListInput) (_ []Machine, err error) {
+	defer c.startOperation(&ctx, "List").end(&err)
+
+	if input == nil {
+		input = &ListInput{}
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet, input.AppName, "/machines", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.URL.RawQuery = input.query().Encode()
+
+	var machines []Machine
+	if err := c.execute(req, &machines); err != nil {
+		return nil, err
+	}
+
+	// Not all filters are supported by the API, apply them all locally
+	result := make([]Machine, 0, len(machines))
+	for _, m := range machines {
+		if input.Matches(m) {
+			result = append(result, m)
+		}
+	}
+
+	return result, nil
+}
+
+func (c *Client) Create(input *CreateInput) (*Machine, error) {
+	return c.CreateContext(context.Background(), input)
+}
+
+func (c *Client) CreateContext(ctx context.Context, input *CreateInput) (_ *Machine, err error) {
+	defer c.startOperation(&ctx, "Create").end(&err)
+
+	if input == nil {
+		return nil, ErrInputRequired
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, input.AppName, "/machines", input)
+	if err != nil {
+		return nil, err
+	}
+
+	var machine Machine
+	err = c.execute(req, &machine)
+	return &machine, err
+}
+
+func (c *Client) Get(input *GetInput) (*Machine, error) {
+	return c.GetContext(context.Background(), input)
+}
+
+func (c *Client) GetContext(ctx context.Context, input *GetInput) (_ *Machine, err error) {
+	defer c.startOperation(&ctx, "Get").end(&err)
+
+	if input == nil {
+		return nil, ErrInputRequired
+	}
+	if input.ID == "" {
+		return nil, ErrMachineIDRequired
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet, input.AppName, "/machines/"+input.ID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var machine Machine
+	err = c.execute(req, &machine)
+	return &machine, err
+}
+
+func (c *Client) Update(input *UpdateInput) (*Machine, error) {
+	return c.UpdateContext(context.Background(), input)
+}
+
+// UpdateContext replaces the configuration of an existing machine. Version
+// mismatches are reported as VersionConflictError.
+func (c *Client) UpdateContext(ctx context.Context, input *UpdateInput) (_ *Machine, err error) {
+	defer c.startOperation(&ctx, "Update").end(&err)
+
+	if input == nil {
+		return nil, ErrInputRequired
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, input.AppName, "/machines/"+input.ID, input)
+	if err != nil {
+		return nil, err
+	}
+	if input.LeaseNonce != "" {
+		req.Header.Set(leaseNonceHeader, input.LeaseNonce)
+	}
+
+	var machine Machine
+	err = c.execute(req, &machine)
+	var apiErr APIError
+	if errors.As(err, &apiErr) && isVersionConflict(apiErr) {
+		err = VersionConflictError{
+			MachineID: input.ID,
+			Version:   input.CurrentVersion,
+			Err:       apiErr,
+		}
+	}
+	return &machine, err
+}
+
+func (c *Client) Stop(input *StopInput) error {
+	return c.StopContext(context.Background(), input)
+}
+
+func (c *Client) StopContext(ctx context.Context, input *StopInput) (err error) {
+	defer c.startOperation(&ctx, "Stop").end(&err)
+
+	if input == nil {
+		return ErrInputRequired
+	}
+	if err := input.Validate(); err != nil {
+		return err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, input.AppName, "/machines/"+input.ID+"/stop", input)
+	if err != nil {
+		return err
+	}
+
+	return c.execute(req, nil)
+}
+
+func (c *Client) Start(input *StartInput) (*StartResult, error) {
+	return c.StartContext(context.Background(), input)
+}
+
+func (c *Client) StartContext(ctx context.Context, input *StartInput) (_ *StartResult, err error) {
+	defer c.startOperation(&ctx, "Start").end(&err)
+
+	if input == nil {
+		return nil, ErrInputRequired
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, input.AppName, "/machines/"+input.ID+"/start", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	result := StartResult{ID: input.ID, AppName: input.AppName}
+	err = c.execute(req, &result)
+	return &result, err
+}
+
+func (c *Client) Restart(input *RestartInput) error {
+	return c.RestartContext(context.Background(), input)
+}
+
+func (c *Client) RestartContext(ctx context.Context, input *RestartInput) (err error) {
+	defer c.startOperation(&ctx, "Restart").end(&err)
+
+	if input == nil {
+		return ErrInputRequired
+	}
+	if err := input.Validate(); err != nil {
+		return err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, input.AppName, "/machines/"+input.ID+"/restart", nil)
+	if err != nil {
+		return err
+	}
+
+	q := req.URL.Query()
+	if input.Signal > 0 {
+		q.Add("signal", signalName(input.Signal))
+	}
+	if input.Timeout > 0 {
+		q.Add("timeout", input.Timeout.String())
+	}
+	if input.ForceStop {
+		q.Add("force_stop", "true")
+	}
+
+	req.URL.RawQuery = q.Encode()
+
+	return c.execute(req, nil)
+}
+
+func (c *Client) Signal(input *SignalInput) error {
+	return c.SignalContext(context.Background(), input)
+}
+
+func (c *Client) SignalContext(ctx context.Context, input *SignalInput) (err error) {
+	defer c.startOperation(&ctx, "Signal").end(&err)
+
+	if input == nil {
+		return ErrInputRequired
+	}
+	if err := input.Validate(); err != nil {
+		return err
+	}
+
+	body := map[string]string{"signal": signalName(input.Signal)}
+
+	req, err := c.newRequest(ctx, http.MethodPost, input.AppName, "/machines/"+input.ID+"/signal", body)
+	if err != nil {
+		return err
+	}
+
+	return c.execute(req, nil)
+}
+
+// Cordon disables traffic routing to the machine, e.g. before maintenance
+func (c *Client) Cordon(input *CordonInput) error {
+	return c.CordonContext(context.Background(), input)
+}
+
+func (c *Client) CordonContext(ctx context.Context, input *CordonInput) (err error) {
+	defer c.startOperation(&ctx, "Cordon").end(&err)
+
+	if input == nil {
+		return ErrInputRequired
+	}
+	if err := input.Validate(); err != nil {
+		return err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, input.AppName, "/machines/"+input.ID+"/cordon", nil)
+	if err != nil {
+		return err
+	}
+
+	return c.execute(req, nil)
+}
+
+// Uncordon enables traffic routing to the previously cordoned machine
+func (c *Client) Uncordon(input *CordonInput) error {
+	return c.UncordonContext(context.Background(), input)
+}
+
+func (c *Client) UncordonContext(ctx context.Context, input *CordonInput) (err error) {
+	defer c.startOperation(&ctx, "Uncordon").end(&err)
+
+	if input == nil {
+		return ErrInputRequired
+	}
+	if err := input.Validate(); err != nil {
+		return err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, input.AppName, "/machines/"+input.ID+"/uncordon", nil)
+	if err != nil {
+		return err
+	}
+
+	return c.execute(req, nil)
 }
 
-func NewClient(appName string) *Client {
-	return &Client{
-		appName:  appName,
-		client:   http.DefaultClient,
-		baseURL:  envVarWithDefault("FLY_API_HOSTNAME", DefaultBaseURL),
-		apiToken: envVarWithDefault("FLY_API_TOKEN", ""),
+// Suspend snapshots the machine memory and stops it, so it can be resumed quickly
+func (c *Client) Suspend(input *SuspendInput) error {
+	return c.SuspendContext(context.Background(), input)
+}
+
+func (c *Client) SuspendContext(ctx context.Context, input *SuspendInput) (err error) {
+	defer c.startOperation(&ctx, "Suspend").end(&err)
+
+	if input == nil {
+		return ErrInputRequired
+	}
+	if err := input.Validate(); err != nil {
+		return err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, input.AppName, "/machines/"+input.ID+"/suspend", nil)
+	if err != nil {
+		return err
+	}
+
+	return c.execute(req, nil)
+}
+
+func (c *Client) Delete(input *DeleteInput) error {
+	return c.DeleteContext(context.Background(), input)
+}
+
+func (c *Client) DeleteContext(ctx context.Context, input *DeleteInput) (err error) {
+	defer c.startOperation(&ctx, "Delete").end(&err)
+
+	if input == nil {
+		return ErrInputRequired
+	}
+	if err := input.Validate(); err != nil {
+		return err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodDelete, input.AppName, "/machines/"+input.ID, nil)
+	if err != nil {
+		return err
+	}
+	if input.Kill {
+		req.URL.RawQuery = url.Values{"force": {"true"}}.Encode()
+	}
+
+	return c.execute(req, nil)
+}
+
+func (c *Client) Exec(input *ExecInput) (*ExecResult, error) {
+	return c.ExecContext(context.Background(), input)
+}
+
+// ExecContext runs the command inside the machine and captures its output.
+// Non-zero exit code is reported as ExitError if input.CheckExitCode is set.
+func (c *Client) ExecContext(ctx context.Context, input *ExecInput) (_ *ExecResult, err error) {
+	defer c.startOperation(&ctx, "Exec").end(&err)
+
+	if input == nil {
+		return nil, ErrInputRequired
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, input.AppName, "/machines/"+input.ID+"/exec", input)
+	if err != nil {
+		return nil, err
+	}
+
+	var result ExecResult
+	if err := c.execute(req, &result); err != nil {
+		return nil, err
+	}
+	if input.CheckExitCode && result.ExitCode != 0 {
+		return &result, ExitError{MachineID: input.ID, Result: &result}
+	}
+
+	return &result, nil
+}
+
+func (c *Client) ListEvents(input *GetInput) (Events, error) {
+	return c.ListEventsContext(context.Background(), input)
+}
+
+func (c *Client) ListEventsContext(ctx context.Context, input *GetInput) (_ Events, err error) {
+	defer c.startOperation(&ctx, "ListEvents").end(&err)
+
+	if input == nil {
+		return nil, ErrInputRequired
+	}
+	if input.ID == "" {
+		return nil, ErrMachineIDRequired
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet, input.AppName, "/machines/"+input.ID+"/events", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var events Events
+	err = c.execute(req, &events)
+	return events, err
+}
+
+func (c *Client) GetMetadata(input *GetInput) (map[string]string, error) {
+	return c.GetMetadataContext(context.Background(), input)
+}
+
+func (c *Client) GetMetadataContext(ctx context.Context, input *GetInput) (_ map[string]string, err error) {
+	defer c.startOperation(&ctx, "GetMetadata").end(&err)
+
+	if input == nil {
+		return nil, ErrInputRequired
+	}
+	if input.ID == "" {
+		return nil, ErrMachineIDRequired
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet, input.AppName, "/machines/"+input.ID+"/metadata", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := map[string]string{}
+	if err := c.execute(req, &metadata); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+func (c *Client) SetMetadataKey(input *MetadataInput) error {
+	return c.SetMetadataKeyContext(context.Background(), input)
+}
+
+func (c *Client) SetMetadataKeyContext(ctx context.Context, input *MetadataInput) (err error) {
+	defer c.startOperation(&ctx, "SetMetadataKey").end(&err)
+
+	if input == nil {
+		return ErrInputRequired
+	}
+	if err := input.Validate(); err != nil {
+		return err
+	}
+
+	body := map[string]string{"value": input.Value}
+
+	req, err := c.newRequest(ctx, http.MethodPost, input.AppName, input.path(), body)
+	if err != nil {
+		return err
+	}
+
+	return c.execute(req, nil)
+}
+
+func (c *Client) DeleteMetadataKey(input *MetadataInput) error {
+	return c.DeleteMetadataKeyContext(context.Background(), input)
+}
+
+func (c *Client) DeleteMetadataKeyContext(ctx context.Context, input *MetadataInput) (err error) {
+	defer c.startOperation(&ctx, "DeleteMetadataKey").end(&err)
+
+	if input == nil {
+		return ErrInputRequired
+	}
+	if err := input.Validate(); err != nil {
+		return err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodDelete, input.AppName, input.path(), nil)
+	if err != nil {
+		return err
+	}
+
+	return c.execute(req, nil)
+}
+
+func (c *Client) Wait(input *WaitInput) error {
+	return c.WaitContext(context.Background(), input)
+}
+
+func (c *Client) WaitContext(ctx context.Context, input *WaitInput) (err error) {
+	defer c.startOperation(&ctx, "Wait").end(&err)
+
+	if input == nil {
+		return ErrInputRequired
+	}
+	if err := input.Validate(); err != nil {
+		return err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet, input.AppName, "/machines/"+input.ID+"/wait", nil)
+	if err != nil {
+		return err
+	}
+
+	q := req.URL.Query()
+	q.Add("state", string(input.State))
+	if input.InstanceID != "" {
+		q.Add("instance_id", input.InstanceID)
+	}
+	if input.Timeout > 0 {
+		q.Add("timeout", input.Timeout.String())
+	}
+
+	req.URL.RawQuery = q.Encode()
+
+	return c.execute(req, nil)
+}
+
+func (c *Client) WaitStarted(ctx context.Context, machine *Machine) error {
+	return c.WaitContext(ctx, &WaitInput{ID: machine.ID, State: StateStarted})
+}
+
+func (c *Client) WaitStopped(ctx context.Context, machine *Machine) error {
+	return c.WaitContext(ctx, &WaitInput{
+		ID:         machine.ID,
+		InstanceID: machine.InstanceID,
+		State:      StateStopped,
+	})
+}
+
+func (c *Client) WaitSuspended(ctx context.Context, machine *Machine) error {
+	return c.WaitContext(ctx, &WaitInput{
+		ID:         machine.ID,
+		InstanceID: machine.InstanceID,
+		State:      StateSuspended,
+	})
+}
+
+func (c *Client) WaitDestroyed(ctx context.Context, machine *Machine) error {
+	return c.WaitContext(ctx, &WaitInput{
+		ID:    machine.ID,
+		State: StateDestroyed,
+	})
+}
+
+func (c *Client) Lease(input *LeaseInput) (*Lease, error) {
+	return c.LeaseContext(context.Background(), input)
+}
+
+func (c *Client) LeaseContext(ctx context.Context, input *LeaseInput) (_ *Lease, err error) {
+	defer c.startOperation(&ctx, "Lease").end(&err)
+
+	if input == nil {
+		return nil, ErrInputRequired
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, input.AppName, "/machines/"+input.ID+"/lease", input)
+	if err != nil {
+		return nil, err
+	}
+	if input.Nonce != "" {
+		req.Header.Set(leaseNonceHeader, input.Nonce)
+	}
+
+	lease := Lease{MachineID: input.ID}
+	err = c.execute(req, &lease)
+	return &lease, err
+}
+
+func (c *Client) ReleaseLease(input *LeaseInput) error {
+	return c.ReleaseLeaseContext(context.Background(), input)
+}
+
+func (c *Client) ReleaseLeaseContext(ctx context.Context, input *LeaseInput) (err error) {
+	defer c.startOperation(&ctx, "ReleaseLease").end(&err)
+
+	if input == nil {
+		return ErrInputRequired
+	}
+	if err := input.Validate(); err != nil {
+		return err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodDelete, input.AppName, "/machines/"+input.ID+"/lease", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(leaseNonceHeader, input.Nonce)
+
+	return c.execute(req, nil)
+}
+
+func (c *Client) ListVolumes(input *ListVolumesInput) ([]Volume, error) {
+	return c.ListVolumesContext(context.Background(), input)
+}
+
+func (c *Client) ListVolumesContext(ctx context.Context, input *ListVolumesInput) (_ []Volume, err error) {
+	defer c.startOperation(&ctx, "ListVolumes").end(&err)
+
+	if input == nil {
+		input = &ListVolumesInput{}
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet, input.AppName, "/volumes", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var volumes []Volume
+	err = c.execute(req, &volumes)
+	return volumes, err
+}
+
+func (c *Client) CreateVolume(input *CreateVolumeInput) (*Volume, error) {
+	return c.CreateVolumeContext(context.Background(), input)
+}
+
+func (c *Client) CreateVolumeContext(ctx context.Context, input *CreateVolumeInput) (_ *Volume, err error) {
+	defer c.startOperation(&ctx, "CreateVolume").end(&err)
+
+	if input == nil {
+		return nil, ErrInputRequired
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, input.AppName, "/volumes", input)
+	if err != nil {
+		return nil, err
+	}
+
+	var volume Volume
+	err = c.execute(req, &volume)
+	return &volume, err
+}
+
+func (c *Client) GetVolume(input *VolumeInput) (*Volume, error) {
+	return c.GetVolumeContext(context.Background(), input)
+}
+
+func (c *Client) GetVolumeContext(ctx context.Context, input *VolumeInput) (_ *Volume, err error) {
+	defer c.startOperation(&ctx, "GetVolume").end(&err)
+
+	if input == nil {
+		return nil, ErrInputRequired
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet, input.AppName, "/volumes/"+input.ID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var volume Volume
+	err = c.execute(req, &volume)
+	return &volume, err
+}
+
+func (c *Client) ExtendVolume(input *ExtendVolumeInput) (*ExtendVolumeResult, error) {
+	return c.ExtendVolumeContext(context.Background(), input)
+}
+
+// ExtendVolumeContext increases the volume size. Machine using the volume might
+// need a restart to pick up the change, see ExtendVolumeResult.NeedsRestart.
+func (c *Client) ExtendVolumeContext(ctx context.Context, input *ExtendVolumeInput) (_ *ExtendVolumeResult, err error) {
+	defer c.startOperation(&ctx, "ExtendVolume").end(&err)
+
+	if input == nil {
+		return nil, ErrInputRequired
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPut, input.AppName, "/volumes/"+input.ID+"/extend", input)
+	if err != nil {
+		return nil, err
+	}
+
+	var result ExtendVolumeResult
+	err = c.execute(req, &result)
+	return &result, err
+}
+
+func (c *Client) DeleteVolume(input *VolumeInput) (*Volume, error) {
+	return c.DeleteVolumeContext(context.Background(), input)
+}
+
+func (c *Client) DeleteVolumeContext(ctx context.Context, input *VolumeInput) (_ *Volume, err error) {
+	defer c.startOperation(&ctx, "DeleteVolume").end(&err)
+
+	if input == nil {
+		return nil, ErrInputRequired
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
 	}
-}
 
-func NewClientWithToken(appName, token string) *Client {
-	client := NewClient(appName)
-	client.SetToken(token)
+	req, err := c.newRequest(ctx, http.MethodDelete, input.AppName, "/volumes/"+input.ID, nil)
+	if err != nil {
+		return nil, err
+	}
 
-	return client
+	var volume Volume
+	err = c.execute(req, &volume)
+	return &volume, err
 }
 
-func (c *Client) SetAppName(name string) {
-	c.appName = name
+func (c *Client) ListVolumeSnapshots(input *VolumeInput) ([]VolumeSnapshot, error) {
+	return c.ListVolumeSnapshotsContext(context.Background(), input)
 }
 
-func (c *Client) GetAppName() string {
-	return c.appName
-}
+func (c *Client) ListVolumeSnapshotsContext(ctx context.Context, input *VolumeInput) (_ []VolumeSnapshot, err error) {
+	defer c.startOperation(&ctx, "ListVolumeSnapshots").end(&err)
 
-func (c *Client) SetToken(token string) {
-	c.apiToken = token
-}
+	if input == nil {
+		return nil, ErrInputRequired
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
 
-func (c *Client) SetBaseURL(url string) {
-	c.baseURL = url
-}
+	req, err := c.newRequest(ctx, http.MethodGet, input.AppName, "/volumes/"+input.ID+"/snapshots", nil)
+	if err != nil {
+		return nil, err
+	}
 
-func (c *Client) GetBaseURL() string {
-	return c.baseURL
+	var snapshots []VolumeSnapshot
+	err = c.execute(req, &snapshots)
+	return snapshots, err
 }
 
-func (c *Client) List(input *ListInput) ([]Machine, error) {
-	return c.ListContext(context.Background(), input)
+func (c *Client) ForkVolume(input *ForkVolumeInput) (*Volume, error) {
+	return c.ForkVolumeContext(context.Background(), input)
 }
 
-func (c *Client) ListContext(ctx context.Context, input *ListInput) ([]Machine, error) {
-	req, err := c.newRequest(ctx, http.MethodGet, "/machines", nil)
+// ForkVolumeContext creates a new volume with a copy of the source volume data
+func (c *Client) ForkVolumeContext(ctx context.Context, input *ForkVolumeInput) (_ *Volume, err error) {
+	defer c.startOperation(&ctx, "ForkVolume").end(&err)
+
+	if input == nil {
+		return nil, ErrInputRequired
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, input.AppName, "/volumes", input)
 	if err != nil {
 		return nil, err
 	}
+
+	var volume Volume
+	err = c.execute(req, &volume)
+	return &volume, err
+}
+
+func (c *Client) ListApps(input *ListAppsInput) ([]App, error) {
+	return c.ListAppsContext(context.Background(), input)
+}
+
+func (c *Client) ListAppsContext(ctx context.Context, input *ListAppsInput) (_ []App, err error) {
+	defer c.startOperation(&ctx, "ListApps").end(&err)
+
 	if input == nil {
-		input = &ListInput{} //nolint:ineffassign
+		return nil, ErrInputRequired
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
 	}
 
-	var machines []Machine
-	err = c.execute(req, &machines)
-	return machines, err
+	req, err := c.newAPIRequest(ctx, http.MethodGet, "/apps", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.URL.RawQuery = url.Values{"org_slug": {input.OrgSlug}}.Encode()
+
+	var result struct {
+		Apps []App `json:"apps"`
+	}
+	if err := c.execute(req, &result); err != nil {
+		return nil, err
+	}
+	return result.Apps, nil
 }
 
-func (c *Client) Create(input *CreateInput) (*Machine, error) {
-	return c.CreateContext(context.Background(), input)
+func (c *Client) CreateApp(input *CreateAppInput) (*App, error) {
+	return c.CreateAppContext(context.Background(), input)
 }
 
-func (c *Client) CreateContext(ctx context.Context, input *CreateInput) (*Machine, error) {
+// CreateAppContext creates a new app in the organization and returns its details
+func (c *Client) CreateAppContext(ctx context.Context, input *CreateAppInput) (_ *App, err error) {
+	defer c.startOperation(&ctx, "CreateApp").end(&err)
+
 	if input == nil {
 		return nil, ErrInputRequired
 	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
 
-	req, err := c.newRequest(ctx, http.MethodPost, "/machines", input)
+	req, err := c.newAPIRequest(ctx, http.MethodPost, "/apps", input)
 	if err != nil {
 		return nil, err
 	}
 
-	var machine Machine
-	err = c.execute(req, &machine)
-	return &machine, err
+	// API does not return app details on create
+	if err := c.execute(req, nil); err != nil {
+		return nil, err
+	}
+
+	return c.GetAppContext(ctx, &AppInput{Name: input.Name})
 }
 
-func (c *Client) Get(input *GetInput) (*Machine, error) {
-	return c.GetContext(context.Background(), input)
+func (c *Client) GetApp(input *AppInput) (*App, error) {
+	return c.GetAppContext(context.Background(), input)
 }
 
-func (c *Client) GetContext(ctx context.Context, input *GetInput) (*Machine, error) {
+func (c *Client) GetAppContext(ctx context.Context, input *AppInput) (_ *App, err error) {
+	defer c.startOperation(&ctx, "GetApp").end(&err)
+
 	if input == nil {
 		return nil, ErrInputRequired
 	}
-	if input.ID == "" {
-		return nil, ErrMachineIDRequired
+	if err := input.Validate(); err != nil {
+		return nil, err
 	}
 
-	req, err := c.newRequest(ctx, http.MethodGet, "/machines/"+input.ID, nil)
+	req, err := c.newAPIRequest(ctx, http.MethodGet, "/apps/"+url.PathEscape(input.Name), nil)
 	if err != nil {
 		return nil, err
 	}
 
-	var machine Machine
-	err = c.execute(req, &machine)
-	return &machine, err
+	var app App
+	err = c.execute(req, &app)
+	return &app, err
 }
 
-func (c *Client) Stop(input *StopInput) error {
-	return c.StopContext(context.Background(), input)
+func (c *Client) DeleteApp(input *AppInput) error {
+	return c.DeleteAppContext(context.Background(), input)
 }
 
-func (c *Client) StopContext(ctx context.Context, input *StopInput) error {
+// DeleteAppContext destroys the app along with all of its machines and volumes
+func (c *Client) DeleteAppContext(ctx context.Context, input *AppInput) (err error) {
+	defer c.startOperation(&ctx, "DeleteApp").end(&err)
+
 	if input == nil {
 		return ErrInputRequired
 	}
@@ -129,7 +939,7 @@ func (c *Client) StopContext(ctx context.Context, input *StopInput) error {
 		return err
 	}
 
-	req, err := c.newRequest(ctx, http.MethodPost, "/machines/"+input.ID+"/stop", nil)
+	req, err := c.newAPIRequest(ctx, http.MethodDelete, "/apps/"+url.PathEscape(input.Name), nil)
 	if err != nil {
 		return err
 	}
@@ -137,11 +947,41 @@ func (c *Client) StopContext(ctx context.Context, input *StopInput) error {
 	return c.execute(req, nil)
 }
 
-func (c *Client) Delete(input *DeleteInput) error {
-	return c.DeleteContext(context.Background(), input)
+func (c *Client) ListSecrets(input *ListSecretsInput) ([]Secret, error) {
+	return c.ListSecretsContext(context.Background(), input)
+}
+
+// ListSecretsContext returns names and digests of the app secrets, values are never returned
+func (c *Client) ListSecretsContext(ctx context.Context, input *ListSecretsInput) (_ []Secret, err error) {
+	defer c.startOperation(&ctx, "ListSecrets").end(&err)
+
+	if input == nil {
+		input = &ListSecretsInput{}
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet, input.AppName, "/secrets", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Secrets []Secret `json:"secrets"`
+	}
+	if err := c.execute(req, &result); err != nil {
+		return nil, err
+	}
+	return result.Secrets, nil
 }
 
-func (c *Client) DeleteContext(ctx context.Context, input *DeleteInput) error {
+func (c *Client) SetSecrets(input *SetSecretsInput) error {
+	return c.SetSecretsContext(context.Background(), input)
+}
+
+// SetSecretsContext creates or updates app secrets. Secret values are redacted
+// from any subsequent API errors returned by the client.
+func (c *Client) SetSecretsContext(ctx context.Context, input *SetSecretsInput) (err error) {
+	defer c.startOperation(&ctx, "SetSecrets").end(&err)
+
 	if input == nil {
 		return ErrInputRequired
 	}
@@ -149,7 +989,11 @@ func (c *Client) DeleteContext(ctx context.Context, input *DeleteInput) error {
 		return err
 	}
 
-	req, err := c.newRequest(ctx, http.MethodDelete, "/machines/"+input.ID, nil)
+	for _, val := range input.Values {
+		c.secrets.add(val)
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, input.AppName, "/secrets", input)
 	if err != nil {
 		return err
 	}
@@ -157,11 +1001,13 @@ func (c *Client) DeleteContext(ctx context.Context, input *DeleteInput) error {
 	return c.execute(req, nil)
 }
 
-func (c *Client) Wait(input *WaitInput) error {
-	return c.WaitContext(context.Background(), input)
+func (c *Client) UnsetSecrets(input *UnsetSecretsInput) error {
+	return c.UnsetSecretsContext(context.Background(), input)
 }
 
-func (c *Client) WaitContext(ctx context.Context, input *WaitInput) error {
+func (c *Client) UnsetSecretsContext(ctx context.Context, input *UnsetSecretsInput) (err error) {
+	defer c.startOperation(&ctx, "UnsetSecrets").end(&err)
+
 	if input == nil {
 		return ErrInputRequired
 	}
@@ -169,49 +1015,149 @@ func (c *Client) WaitContext(ctx context.Context, input *WaitInput) error {
 		return err
 	}
 
-	req, err := c.newRequest(ctx, http.MethodGet, "/machines/"+input.ID+"/wait", nil)
+	for _, name := range input.Names {
+		req, err := c.newRequest(ctx, http.MethodDelete, input.AppName, "/secrets/"+url.PathEscape(name), nil)
+		if err != nil {
+			return err
+		}
+		if err := c.execute(req, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) ListIPAddresses(input *ListIPAddressesInput) ([]IPAddress, error) {
+	return c.ListIPAddressesContext(context.Background(), input)
+}
+
+func (c *Client) ListIPAddressesContext(ctx context.Context, input *ListIPAddressesInput) (_ []IPAddress, err error) {
+	defer c.startOperation(&ctx, "ListIPAddresses").end(&err)
+
+	if input == nil {
+		input = &ListIPAddressesInput{}
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet, input.AppName, "/ip_assignments", nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	q := req.URL.Query()
-	q.Add("state", string(input.State))
-	if input.InstanceID != "" {
-		q.Add("instance_id", input.InstanceID)
+	var result struct {
+		IPs []IPAddress `json:"ips"`
 	}
-	if input.Timeout > 0 {
-		q.Add("timeout", input.Timeout.String())
+	if err := c.execute(req, &result); err != nil {
+		return nil, err
 	}
+	return result.IPs, nil
+}
 
-	req.URL.RawQuery = q.Encode()
+func (c *Client) AllocateIPAddress(input *AllocateIPAddressInput) (*IPAddress, error) {
+	return c.AllocateIPAddressContext(context.Background(), input)
+}
+
+// AllocateIPAddressContext assigns a new public or private (Flycast) IP address to the app
+func (c *Client) AllocateIPAddressContext(ctx context.Context, input *AllocateIPAddressInput) (_ *IPAddress, err error) {
+	defer c.startOperation(&ctx, "AllocateIPAddress").end(&err)
+
+	if input == nil {
+		return nil, ErrInputRequired
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, input.AppName, "/ip_assignments", input)
+	if err != nil {
+		return nil, err
+	}
+
+	var ip IPAddress
+	err = c.execute(req, &ip)
+	return &ip, err
+}
+
+func (c *Client) ReleaseIPAddress(input *ReleaseIPAddressInput) error {
+	return c.ReleaseIPAddressContext(context.Background(), input)
+}
+
+func (c *Client) ReleaseIPAddressContext(ctx context.Context, input *ReleaseIPAddressInput) (err error) {
+	defer c.startOperation(&ctx, "ReleaseIPAddress").end(&err)
+
+	if input == nil {
+		return ErrInputRequired
+	}
+	if err := input.Validate(); err != nil {
+		return err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodDelete, input.AppName, "/ip_assignments/"+url.PathEscape(input.IP), nil)
+	if err != nil {
+		return err
+	}
 
 	return c.execute(req, nil)
 }
 
-func (c *Client) WaitStarted(ctx context.Context, machine *Machine) error {
-	return c.WaitContext(ctx, &WaitInput{ID: machine.ID, State: StateStarted})
+func (c *Client) ListCertificates(input *ListCertificatesInput) ([]Certificate, error) {
+	return c.ListCertificatesContext(context.Background(), input)
 }
 
-func (c *Client) WaitStopped(ctx context.Context, machine *Machine) error {
-	return c.WaitContext(ctx, &WaitInput{
-		ID:         machine.ID,
-		InstanceID: machine.InstanceID,
-		State:      StateStopped,
-	})
+func (c *Client) ListCertificatesContext(ctx context.Context, input *ListCertificatesInput) (_ []Certificate, err error) {
+	defer c.startOperation(&ctx, "ListCertificates").end(&err)
+
+	if input == nil {
+		input = &ListCertificatesInput{}
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet, input.AppName, "/certificates", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Certificates []Certificate `json:"certificates"`
+	}
+	if err := c.execute(req, &result); err != nil {
+		return nil, err
+	}
+	return result.Certificates, nil
 }
 
-func (c *Client) WaitDestroyed(ctx context.Context, machine *Machine) error {
-	return c.WaitContext(ctx, &WaitInput{
-		ID:    machine.ID,
-		State: StateDestroyed,
-	})
+func (c *Client) AddCertificate(input *CertificateInput) (*Certificate, error) {
+	return c.AddCertificateContext(context.Background(), input)
 }
 
-func (c *Client) Lease(input *LeaseInput) (*Lease, error) {
-	return c.LeaseContext(context.Background(), input)
+// AddCertificateContext requests a TLS certificate for the custom hostname.
+// The certificate is issued once DNS is configured, see CheckCertificateContext.
+func (c *Client) AddCertificateContext(ctx context.Context, input *CertificateInput) (_ *Certificate, err error) {
+	defer c.startOperation(&ctx, "AddCertificate").end(&err)
+
+	if input == nil {
+		return nil, ErrInputRequired
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, input.AppName, "/certificates/acme", input)
+	if err != nil {
+		return nil, err
+	}
+
+	var cert Certificate
+	err = c.execute(req, &cert)
+	return &cert, err
+}
+
+func (c *Client) GetCertificate(input *CertificateInput) (*Certificate, error) {
+	return c.GetCertificateContext(context.Background(), input)
 }
 
-func (c *Client) LeaseContext(ctx context.Context, input *LeaseInput) (*Lease, error) {
+func (c *Client) GetCertificateContext(ctx context.Context, input *CertificateInput) (_ *Certificate, err error) {
+	defer c.startOperation(&ctx, "GetCertificate").end(&err)
+
 	if input == nil {
 		return nil, ErrInputRequired
 	}
@@ -219,21 +1165,48 @@ func (c *Client) LeaseContext(ctx context.Context, input *LeaseInput) (*Lease, e
 		return nil, err
 	}
 
-	req, err := c.newRequest(ctx, http.MethodPost, "/machines/"+input.ID+"/lease", input)
+	req, err := c.newRequest(ctx, http.MethodGet, input.AppName, input.path(), nil)
 	if err != nil {
 		return nil, err
 	}
 
-	var lease Lease
-	err = c.execute(req, &lease)
-	return &lease, err
+	var cert Certificate
+	err = c.execute(req, &cert)
+	return &cert, err
 }
 
-func (c *Client) ReleaseLease(input *LeaseInput) error {
-	return c.ReleaseLeaseContext(context.Background(), input)
+func (c *Client) CheckCertificate(input *CertificateInput) (*Certificate, error) {
+	return c.CheckCertificateContext(context.Background(), input)
+}
+
+// CheckCertificateContext verifies hostname DNS configuration and returns the updated certificate status
+func (c *Client) CheckCertificateContext(ctx context.Context, input *CertificateInput) (_ *Certificate, err error) {
+	defer c.startOperation(&ctx, "CheckCertificate").end(&err)
+
+	if input == nil {
+		return nil, ErrInputRequired
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, input.AppName, input.path()+"/check", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var cert Certificate
+	err = c.execute(req, &cert)
+	return &cert, err
+}
+
+func (c *Client) DeleteCertificate(input *CertificateInput) error {
+	return c.DeleteCertificateContext(context.Background(), input)
 }
 
-func (c *Client) ReleaseLeaseContext(ctx context.Context, input *LeaseInput) error {
+func (c *Client) DeleteCertificateContext(ctx context.Context, input *CertificateInput) (err error) {
+	defer c.startOperation(&ctx, "DeleteCertificate").end(&err)
+
 	if input == nil {
 		return ErrInputRequired
 	}
@@ -241,11 +1214,10 @@ func (c *Client) ReleaseLeaseContext(ctx context.Context, input *LeaseInput) err
 		return err
 	}
 
-	req, err := c.newRequest(ctx, http.MethodDelete, "/machines/"+input.ID+"/lease", nil)
+	req, err := c.newRequest(ctx, http.MethodDelete, input.AppName, input.path(), nil)
 	if err != nil {
 		return err
 	}
-	req.Header.Add("fly-machine-lease-nonce", input.Nonce)
 
 	return c.execute(req, nil)
 }
@@ -277,13 +1249,43 @@ func (c *Client) CreateGroup(ctx context.Context, input *CreateGroupInput) ([]*M
 }
 
 func (c *Client) urlForPath(path string) string {
-	return fmt.Sprintf("%s/v1/apps/%s%s", c.baseURL, c.appName, path)
+	return fmt.Sprintf("%s/v1%s", c.baseURL, path)
+}
+
+// machineIDFromPath extracts machine ID from the request path, if present
+func machineIDFromPath(path string) string {
+	_, rest, found := strings.Cut(path, "/machines/")
+	if !found {
+		return ""
+	}
+	id, _, _ := strings.Cut(rest, "/")
+	return id
 }
 
-func (c *Client) newRequest(ctx context.Context, method string, path string, body any) (*http.Request, error) {
-	if c.appName == "" {
+// newRequest builds the API request for the app path. Client's app name is used
+// unless the appName is set.
+func (c *Client) newRequest(ctx context.Context, method string, appName string, path string, body any) (*http.Request, error) {
+	if appName == "" {
+		appName = c.appName
+	}
+	if appName == "" {
 		return nil, ErrAppNameRequired
 	}
+
+	req, err := c.newAPIRequest(ctx, method, "/apps/"+url.PathEscape(appName)+path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if method != http.MethodGet && c.lease.coversPath(path) {
+		req.Header.Set(leaseNonceHeader, c.lease.Nonce)
+	}
+
+	return req, nil
+}
+
+// newAPIRequest builds the API request for the path that is not scoped to an app
+func (c *Client) newAPIRequest(ctx context.Context, method string, path string, body any) (*http.Request, error) {
 	if c.apiToken == "" {
 		return nil, ErrAuthRequired
 	}
@@ -298,29 +1300,72 @@ func (c *Client) newRequest(ctx context.Context, method string, path string, bod
 		return nil, err
 	}
 
-	req.Header.Add("User-Agent", ClientVersion())
-	req.Header.Add("Authorization", "Bearer "+c.apiToken)
-	req.Header.Add("Content-Type", "application/json")
+	for key, values := range c.headers {
+		for _, val := range values {
+			req.Header.Add(key, val)
+		}
+	}
+
+	req.Header.Set("User-Agent", c.userAgent)
+	req.Header.Set("Authorization", "Bearer "+c.apiToken)
+	req.Header.Set("Content-Type", "application/json")
 
 	return req, nil
 }
 
+// execute performs the request with middleware hooks and decodes the response into out
 func (c *Client) execute(req *http.Request, out any) error {
-	resp, err := c.client.Do(req)
+	call := newCall(req)
+	err := c.executeCall(call, out)
+	if err != nil {
+		c.onError(call, err)
+	}
+	c.done(call, err)
+	return err
+}
+
+func (c *Client) executeCall(call *Call, out any) error {
+	if err := c.beforeRequest(call); err != nil {
+		return err
+	}
+	start := time.Now()
+	resp, err := c.do(call)
+	call.Duration = time.Since(start)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
+	call.StatusCode = resp.StatusCode
+	c.afterResponse(call, resp)
+
 	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
 		if out == nil {
 			_, err := io.Copy(io.Discard, resp.Body)
 			return err
 		}
-		return json.NewDecoder(resp.Body).Decode(out)
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return err
+		}
+		if machine, ok := out.(*Machine); ok {
+			call.Region = machine.Region
+		}
+		return nil
 	}
 
-	return apiErrorFromResponse(resp)
+	err = apiErrorFromResponse(resp)
+	apiErr, ok := err.(APIError)
+	if !ok {
+		return err
+	}
+
+	apiErr = c.secrets.redactError(apiErr)
+	apiErr.Operation = call.Operation
+	apiErr.MachineID = call.MachineID
+	if call.MachineID != "" && isLeaseConflict(apiErr) {
+		return LeaseHeldError{MachineID: call.MachineID, Err: apiErr}
+	}
+	return apiErr
 }
 
 func (c *Client) jsonBody(body any) (io.Reader, error) {
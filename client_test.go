@@ -2,7 +2,9 @@ package machines_test
 
 import (
 	"context"
+	"encoding/json"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 	"time"
 
@@ -29,6 +31,51 @@ func TestListContext(t *testing.T) {
 	require.Equal(t, 1, len(list))
 	require.Equal(t, "4d89040f431938", list[0].ID)
 	require.Equal(t, "winter-cloud-3782", list[0].Name)
+
+	examples := []struct {
+		input *machines.ListInput
+		count int
+	}{
+		{&machines.ListInput{State: machines.StateStopped}, 1},
+		{&machines.ListInput{State: machines.StateStarted}, 0},
+		{&machines.ListInput{Region: "ord"}, 1},
+		{&machines.ListInput{Region: "iad"}, 0},
+		{&machines.ListInput{NamePrefix: "winter-"}, 1},
+		{&machines.ListInput{NamePrefix: "summer-"}, 0},
+		{&machines.ListInput{Metadata: map[string]string{"tenant": "1"}}, 0},
+		{&machines.ListInput{IncludeDeleted: true, State: machines.StateStopped, Region: "ord"}, 1},
+		{&machines.ListInput{IncludeDeleted: true}, 2},
+		{&machines.ListInput{State: machines.StateDestroyed}, 1},
+		{&machines.ListInput{State: machines.StateDestroying}, 0},
+	}
+
+	for _, ex := range examples {
+		list, err := client.ListContext(context.Background(), ex.input)
+		require.NoError(t, err)
+		require.Equal(t, ex.count, len(list), "%+v", ex.input)
+	}
+}
+
+func TestListInputMatches(t *testing.T) {
+	machine := machines.Machine{
+		Name:   "web-1",
+		State:  machines.StateStarted,
+		Region: "iad",
+		Config: machines.Config{Metadata: map[string]string{"tenant": "1", "release": "v2"}},
+	}
+
+	require.True(t, machines.ListInput{}.Matches(machine))
+	require.True(t, machines.ListInput{Metadata: map[string]string{"tenant": "1"}}.Matches(machine))
+	require.True(t, machines.ListInput{
+		State:      machines.StateStarted,
+		Region:     "iad",
+		NamePrefix: "web",
+		Metadata:   map[string]string{"tenant": "1", "release": "v2"},
+	}.Matches(machine))
+
+	require.False(t, machines.ListInput{Metadata: map[string]string{"tenant": "2"}}.Matches(machine))
+	require.False(t, machines.ListInput{Metadata: map[string]string{"foo": ""}}.Matches(machine))
+	require.False(t, machines.ListInput{NamePrefix: "worker"}.Matches(machine))
 }
 
 func TestGetContext(t *testing.T) {
@@ -40,6 +87,13 @@ func TestGetContext(t *testing.T) {
 
 	_, err = client.GetContext(context.Background(), &machines.GetInput{ID: "foo"})
 	require.Equal(t, "machine does not exist", err.Error())
+	require.True(t, machines.IsNotFound(err))
+	require.False(t, machines.IsRetryable(err))
+
+	var apiErr machines.APIError
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, "GET /apps/{app}/machines/{id}", apiErr.Operation)
+	require.Equal(t, "foo", apiErr.MachineID)
 
 	machine, err := client.GetContext(context.Background(), &machines.GetInput{ID: "1"})
 	require.Nil(t, err)
@@ -68,6 +122,47 @@ func TestCreateContext(t *testing.T) {
 	require.ErrorContains(t, err, "context deadline exceeded")
 }
 
+func TestUpdateContext(t *testing.T) {
+	_, err := client.UpdateContext(context.Background(), nil)
+	require.Equal(t, machines.ErrInputRequired, err)
+
+	_, err = client.UpdateContext(context.Background(), &machines.UpdateInput{})
+	require.Equal(t, machines.ErrMachineIDRequired, err)
+
+	_, err = client.UpdateContext(context.Background(), &machines.UpdateInput{ID: "1"})
+	require.Equal(t, machines.ErrConfigRequired, err)
+
+	_, err = client.UpdateContext(context.Background(), &machines.UpdateInput{ID: "foo", Config: &machines.Config{}})
+	require.Equal(t, "machine does not exist", err.Error())
+
+	_, err = client.UpdateContext(context.Background(), &machines.UpdateInput{
+		ID:             "1",
+		Config:         &machines.Config{},
+		CurrentVersion: "stale",
+	})
+	var conflictErr machines.VersionConflictError
+	require.ErrorAs(t, err, &conflictErr)
+	require.Equal(t, "1", conflictErr.MachineID)
+	require.Equal(t, "stale", conflictErr.Version)
+	require.Equal(t, 412, conflictErr.Err.StatusCode)
+
+	_, err = client.UpdateContext(context.Background(), &machines.UpdateInput{
+		ID:         "1",
+		Config:     &machines.Config{},
+		LeaseNonce: "other",
+	})
+	require.Equal(t, "lease currently held by owner@corp.com", err.Error())
+
+	machine, err := client.UpdateContext(context.Background(), &machines.UpdateInput{
+		ID:             "1",
+		Config:         &machines.Config{Image: "org/repo:v1"},
+		CurrentVersion: "01GW3R0N8WCJN9QCQTN3RFEA3N",
+		LeaseNonce:     "1234",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "4d89040f431938", machine.ID)
+}
+
 func TestLeaseContext(t *testing.T) {
 	_, err := client.LeaseContext(context.Background(), nil)
 	require.Equal(t, err, machines.ErrInputRequired)
@@ -81,12 +176,84 @@ func TestLeaseContext(t *testing.T) {
 	lease, err := client.LeaseContext(context.Background(), &machines.LeaseInput{ID: "1"})
 	require.NoError(t, err)
 	require.Equal(t, &machines.Lease{
+		MachineID: "1",
 		Nonce:     "1234",
 		ExpiresAt: 1679456889,
 		Owner:     "owner@corp.com",
 	}, lease)
 }
 
+func TestWithLease(t *testing.T) {
+	err := client.StopContext(context.Background(), &machines.StopInput{ID: "leased"})
+	require.ErrorIs(t, err, machines.ErrLeaseHeld)
+
+	var leaseErr machines.LeaseHeldError
+	require.ErrorAs(t, err, &leaseErr)
+	require.Equal(t, "leased", leaseErr.MachineID)
+	require.Equal(t, "lease currently held by owner@corp.com", leaseErr.Error())
+
+	leased := client.WithLease(&machines.Lease{MachineID: "leased", Nonce: "1234"})
+	require.Nil(t, client.GetLease())
+	require.Equal(t, "1234", leased.GetLease().Nonce)
+
+	require.NoError(t, leased.StopContext(context.Background(), &machines.StopInput{ID: "leased"}))
+	require.NoError(t, leased.RestartContext(context.Background(), &machines.RestartInput{ID: "leased"}))
+	require.NoError(t, leased.DeleteContext(context.Background(), &machines.DeleteInput{ID: "leased"}))
+
+	_, err = leased.StartContext(context.Background(), &machines.StartInput{ID: "leased"})
+	require.NoError(t, err)
+
+	// Nonce is only sent for the leased machine
+	leased = client.WithLease(&machines.Lease{MachineID: "1", Nonce: "other"})
+	err = leased.StopContext(context.Background(), &machines.StopInput{ID: "leased"})
+	require.ErrorIs(t, err, machines.ErrLeaseHeld)
+	err = leased.StopContext(context.Background(), &machines.StopInput{ID: "1"})
+	require.ErrorIs(t, err, machines.ErrLeaseHeld)
+}
+
+func TestCordonContext(t *testing.T) {
+	err := client.CordonContext(context.Background(), nil)
+	require.Equal(t, machines.ErrInputRequired, err)
+
+	err = client.CordonContext(context.Background(), &machines.CordonInput{})
+	require.Equal(t, machines.ErrMachineIDRequired, err)
+
+	err = client.UncordonContext(context.Background(), &machines.CordonInput{})
+	require.Equal(t, machines.ErrMachineIDRequired, err)
+
+	err = client.CordonContext(context.Background(), &machines.CordonInput{ID: "foo"})
+	require.Equal(t, "machine does not exist", err.Error())
+
+	err = client.UncordonContext(context.Background(), &machines.CordonInput{ID: "cordon"})
+	require.Equal(t, "machine is not cordoned", err.Error())
+
+	err = client.CordonContext(context.Background(), &machines.CordonInput{ID: "cordon"})
+	require.NoError(t, err)
+
+	err = client.UncordonContext(context.Background(), &machines.CordonInput{ID: "cordon"})
+	require.NoError(t, err)
+
+	err = client.UncordonContext(context.Background(), &machines.CordonInput{ID: "cordon"})
+	require.Equal(t, "machine is not cordoned", err.Error())
+}
+
+func TestSuspendContext(t *testing.T) {
+	err := client.SuspendContext(context.Background(), nil)
+	require.Equal(t, machines.ErrInputRequired, err)
+
+	err = client.SuspendContext(context.Background(), &machines.SuspendInput{})
+	require.Equal(t, machines.ErrMachineIDRequired, err)
+
+	err = client.SuspendContext(context.Background(), &machines.SuspendInput{ID: "foo"})
+	require.Equal(t, "machine does not exist", err.Error())
+
+	err = client.SuspendContext(context.Background(), &machines.SuspendInput{ID: "1"})
+	require.NoError(t, err)
+
+	err = client.WaitSuspended(context.Background(), &machines.Machine{ID: "1"})
+	require.NoError(t, err)
+}
+
 func TestDeleteContext(t *testing.T) {
 	err := client.DeleteContext(context.Background(), nil)
 	require.Equal(t, machines.ErrInputRequired, err)
@@ -99,6 +266,160 @@ func TestDeleteContext(t *testing.T) {
 
 	err = client.DeleteContext(context.Background(), &machines.DeleteInput{ID: "1"})
 	require.NoError(t, err)
+
+	err = client.DeleteContext(context.Background(), &machines.DeleteInput{ID: "running"})
+	require.Equal(t, "machine still active, refusing to delete", err.Error())
+
+	err = client.DeleteContext(context.Background(), &machines.DeleteInput{ID: "running", Kill: true})
+	require.NoError(t, err)
+}
+
+func TestAppNameOverride(t *testing.T) {
+	_, err := client.GetContext(context.Background(), &machines.GetInput{ID: "1", AppName: "missing"})
+	require.Equal(t, "app not found", err.Error())
+
+	machine, err := client.GetContext(context.Background(), &machines.GetInput{ID: "1", AppName: "other"})
+	require.NoError(t, err)
+	require.Equal(t, "4d89040f431938", machine.ID)
+
+	list, err := client.ListContext(context.Background(), &machines.ListInput{AppName: "other"})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(list))
+
+	_, err = client.CreateContext(context.Background(), &machines.CreateInput{AppName: "other", Config: &machines.Config{}})
+	require.NoError(t, err)
+
+	err = client.StopContext(context.Background(), &machines.StopInput{ID: "1", AppName: "other"})
+	require.NoError(t, err)
+
+	err = client.DeleteContext(context.Background(), &machines.DeleteInput{ID: "1", AppName: "missing"})
+	require.Equal(t, "app not found", err.Error())
+
+	err = client.WaitContext(context.Background(), &machines.WaitInput{ID: "1", AppName: "other", State: machines.StateStarted})
+	require.NoError(t, err)
+
+	// App name is still required if the client has none
+	_, err = machines.NewClientWithToken("", "token").GetContext(context.Background(), &machines.GetInput{ID: "1"})
+	require.Equal(t, machines.ErrAppNameRequired, err)
+}
+
+func TestExecContext(t *testing.T) {
+	_, err := client.ExecContext(context.Background(), nil)
+	require.Equal(t, machines.ErrInputRequired, err)
+
+	_, err = client.ExecContext(context.Background(), &machines.ExecInput{})
+	require.Equal(t, machines.ErrMachineIDRequired, err)
+
+	_, err = client.ExecContext(context.Background(), &machines.ExecInput{ID: "1"})
+	require.Equal(t, machines.ErrCommandRequired, err)
+
+	_, err = client.ExecContext(context.Background(), &machines.ExecInput{ID: "foo", Command: []string{"echo"}})
+	require.Equal(t, "machine does not exist", err.Error())
+
+	result, err := client.ExecContext(context.Background(), &machines.ExecInput{
+		ID:      "1",
+		Command: []string{"echo", "hello", "world"},
+		Timeout: 30 * time.Second,
+	})
+	require.NoError(t, err)
+	require.Equal(t, &machines.ExecResult{Stdout: "hello world\n"}, result)
+
+	result, err = client.ExecContext(context.Background(), &machines.ExecInput{
+		ID:      "1",
+		Command: []string{"cat"},
+		Stdin:   "input",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "input", result.Stdout)
+
+	result, err = client.ExecContext(context.Background(), &machines.ExecInput{ID: "1", Command: []string{"false"}})
+	require.NoError(t, err)
+	require.Equal(t, 1, result.ExitCode)
+	require.Equal(t, "command failed\n", result.Stderr)
+
+	result, err = client.ExecContext(context.Background(), &machines.ExecInput{
+		ID:            "1",
+		Command:       []string{"false"},
+		CheckExitCode: true,
+	})
+	require.Equal(t, "command exited with code 1 on machine 1", err.Error())
+	var exitErr machines.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	require.Equal(t, result, exitErr.Result)
+}
+
+func TestExecInputJSON(t *testing.T) {
+	data, err := json.Marshal(machines.ExecInput{ID: "1", Command: []string{"ls", "-la"}, Timeout: 1500 * time.Millisecond})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"command":["ls","-la"],"timeout":2}`, string(data))
+
+	data, err = json.Marshal(machines.ExecInput{ID: "1", Command: []string{"ls"}, Timeout: 200 * time.Millisecond})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"command":["ls"],"timeout":1}`, string(data))
+
+	data, err = json.Marshal(machines.ExecInput{ID: "1", Command: []string{"ls"}})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"command":["ls"]}`, string(data))
+}
+
+func TestListEventsContext(t *testing.T) {
+	_, err := client.ListEventsContext(context.Background(), nil)
+	require.Equal(t, machines.ErrInputRequired, err)
+
+	_, err = client.ListEventsContext(context.Background(), &machines.GetInput{})
+	require.Equal(t, machines.ErrMachineIDRequired, err)
+
+	_, err = client.ListEventsContext(context.Background(), &machines.GetInput{ID: "foo"})
+	require.Equal(t, "machine does not exist", err.Error())
+
+	events, err := client.ListEventsContext(context.Background(), &machines.GetInput{ID: "1"})
+	require.NoError(t, err)
+	require.Equal(t, 4, len(events))
+	require.Equal(t, machines.EventTypeExit, events[0].Type)
+	require.Equal(t, machines.EventStatusStopped, events[0].Status)
+
+	exit := events.LastExit()
+	require.NotNil(t, exit)
+	require.True(t, exit.OOMKilled)
+	require.Equal(t, 137, exit.GuestExitCode)
+}
+
+func TestMetadataContext(t *testing.T) {
+	_, err := client.GetMetadataContext(context.Background(), nil)
+	require.Equal(t, machines.ErrInputRequired, err)
+
+	_, err = client.GetMetadataContext(context.Background(), &machines.GetInput{})
+	require.Equal(t, machines.ErrMachineIDRequired, err)
+
+	_, err = client.GetMetadataContext(context.Background(), &machines.GetInput{ID: "foo"})
+	require.Equal(t, "machine does not exist", err.Error())
+
+	err = client.SetMetadataKeyContext(context.Background(), nil)
+	require.Equal(t, machines.ErrInputRequired, err)
+
+	err = client.SetMetadataKeyContext(context.Background(), &machines.MetadataInput{ID: "1"})
+	require.Equal(t, machines.ErrMetadataKeyRequired, err)
+
+	err = client.DeleteMetadataKeyContext(context.Background(), &machines.MetadataInput{})
+	require.Equal(t, machines.ErrMachineIDRequired, err)
+
+	err = client.DeleteMetadataKeyContext(context.Background(), &machines.MetadataInput{ID: "1", Key: "missing"})
+	require.Equal(t, "metadata key not found", err.Error())
+
+	err = client.SetMetadataKeyContext(context.Background(), &machines.MetadataInput{ID: "1", Key: "release", Value: "v2"})
+	require.NoError(t, err)
+
+	metadata, err := client.GetMetadataContext(context.Background(), &machines.GetInput{ID: "1"})
+	require.NoError(t, err)
+	require.Equal(t, "acme", metadata["tenant"])
+	require.Equal(t, "v2", metadata["release"])
+
+	err = client.DeleteMetadataKeyContext(context.Background(), &machines.MetadataInput{ID: "1", Key: "release"})
+	require.NoError(t, err)
+
+	metadata, err = client.GetMetadataContext(context.Background(), &machines.GetInput{ID: "1"})
+	require.NoError(t, err)
+	require.NotContains(t, metadata, "release")
 }
 
 func TestWaitContext(t *testing.T) {
@@ -141,6 +462,98 @@ func TestStopContext(t *testing.T) {
 
 	err = client.StopContext(context.Background(), &machines.StopInput{ID: "1"})
 	require.NoError(t, err)
+
+	err = client.StopContext(context.Background(), &machines.StopInput{ID: "1", Signal: 99})
+	require.Equal(t, "invalid signal", err.Error())
+
+	err = client.StopContext(context.Background(), &machines.StopInput{
+		ID:      "1",
+		Signal:  machines.SignalTERM,
+		Timeout: 5 * time.Minute,
+	})
+	require.NoError(t, err)
+}
+
+func TestStopInputJSON(t *testing.T) {
+	data, err := json.Marshal(machines.StopInput{ID: "1"})
+	require.NoError(t, err)
+	require.JSONEq(t, `{}`, string(data))
+
+	data, err = json.Marshal(machines.StopInput{ID: "1", Signal: machines.SignalTERM, Timeout: 90 * time.Second})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"signal":"SIGTERM","timeout":"1m30s"}`, string(data))
+}
+
+func TestStartContext(t *testing.T) {
+	_, err := client.StartContext(context.Background(), nil)
+	require.Equal(t, machines.ErrInputRequired, err)
+
+	_, err = client.StartContext(context.Background(), &machines.StartInput{})
+	require.Equal(t, machines.ErrMachineIDRequired, err)
+
+	_, err = client.StartContext(context.Background(), &machines.StartInput{ID: "foo"})
+	require.Equal(t, "machine does not exist", err.Error())
+
+	result, err := client.StartContext(context.Background(), &machines.StartInput{ID: "1"})
+	require.NoError(t, err)
+	require.Equal(t, machines.StateStopped, result.PreviousState)
+	require.Equal(t, "01GW3R0N8WCJN9QCQTN3RFEA3N", result.InstanceID)
+	require.Equal(t, &machines.WaitInput{ID: "1", InstanceID: "01GW3R0N8WCJN9QCQTN3RFEA3N", State: machines.StateStarted}, result.WaitInput())
+}
+
+func TestRestartContext(t *testing.T) {
+	err := client.RestartContext(context.Background(), nil)
+	require.Equal(t, machines.ErrInputRequired, err)
+
+	err = client.RestartContext(context.Background(), &machines.RestartInput{})
+	require.Equal(t, machines.ErrMachineIDRequired, err)
+
+	err = client.RestartContext(context.Background(), &machines.RestartInput{ID: "foo"})
+	require.Equal(t, "machine does not exist", err.Error())
+
+	var query url.Values
+	client := machines.NewClient("app",
+		machines.WithBaseURL(server.URL),
+		machines.WithToken("api_token"),
+		machines.WithMiddleware(machines.Middleware{
+			BeforeRequest: func(call *machines.Call) error {
+				query = call.Request.URL.Query()
+				return nil
+			},
+		}),
+	)
+
+	err = client.RestartContext(context.Background(), &machines.RestartInput{
+		ID:      "1",
+		Signal:  machines.SignalTERM,
+		Timeout: 10 * time.Second,
+	})
+	require.NoError(t, err)
+	require.Equal(t, url.Values{"signal": {"SIGTERM"}, "timeout": {"10s"}}, query)
+
+	err = client.RestartContext(context.Background(), &machines.RestartInput{ID: "1", ForceStop: true})
+	require.NoError(t, err)
+	require.Equal(t, url.Values{"force_stop": {"true"}}, query)
+}
+
+func TestSignalContext(t *testing.T) {
+	err := client.SignalContext(context.Background(), nil)
+	require.Equal(t, machines.ErrInputRequired, err)
+
+	err = client.SignalContext(context.Background(), &machines.SignalInput{})
+	require.Equal(t, machines.ErrMachineIDRequired, err)
+
+	err = client.SignalContext(context.Background(), &machines.SignalInput{ID: "1"})
+	require.Equal(t, machines.ErrSignalRequired, err)
+
+	err = client.SignalContext(context.Background(), &machines.SignalInput{ID: "foo", Signal: machines.SignalHUP})
+	require.Equal(t, "machine does not exist", err.Error())
+
+	err = client.SignalContext(context.Background(), &machines.SignalInput{ID: "1", Signal: 99})
+	require.Equal(t, "invalid signal", err.Error())
+
+	err = client.SignalContext(context.Background(), &machines.SignalInput{ID: "1", Signal: machines.SignalHUP})
+	require.NoError(t, err)
 }
 
 var (
@@ -149,7 +562,7 @@ var (
 )
 
 func init() {
-	server = testdata.Server("app")
+	server = testdata.Server("app", "other")
 	client = testClient(server.URL)
 }
 
@@ -12,6 +12,21 @@ type Config struct {
 	Mounts      []MountConfig          `json:"mounts,omitempty"`
 	Checks      map[string]CheckConfig `json:"checks,omitempty"`
 	Metadata    map[string]string      `json:"metadata,omitempty"`
+	Secrets     []SecretConfig         `json:"secrets,omitempty"`
+}
+
+// RedactedEnv returns env vars with values of secret-backed vars redacted
+func (c Config) RedactedEnv() map[string]string {
+	env := make(map[string]string, len(c.Env))
+	for k, v := range c.Env {
+		env[k] = v
+	}
+	for _, secret := range c.Secrets {
+		if _, ok := env[secret.EnvVar]; ok {
+			env[secret.EnvVar] = RedactedValue
+		}
+	}
+	return env
 }
 
 type InitConfig struct {
@@ -68,6 +83,13 @@ type CheckHeader struct {
 	Values []string `json:"values"`
 }
 
+// SecretConfig exposes the app secret to the machine as env var, so the value is
+// never stored in the machine config
+type SecretConfig struct {
+	EnvVar string `json:"env_var"`
+	Name   string `json:"name"`
+}
+
 type MountConfig struct {
 	VolumeID string `json:"volume"`
 	Path     string `json:"path"`
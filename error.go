@@ -5,10 +5,47 @@ import (
 )
 
 var (
-	ErrAppNameRequired   = errors.New("app name is required")
-	ErrAuthRequired      = errors.New("api token is required")
-	ErrInvalidAuth       = errors.New("invalid or expired auth token")
-	ErrInputRequired     = errors.New("request input required")
-	ErrMachineIDRequired = errors.New("machine id is required")
-	ErrInvalidWaitState  = errors.New("state must be one of started/stopped/destroyed")
+	ErrAppNameRequired       = errors.New("app name is required")
+	ErrAuthRequired          = errors.New("api token is required")
+	ErrInvalidAuth           = errors.New("invalid or expired auth token")
+	ErrInputRequired         = errors.New("request input required")
+	ErrMachineIDRequired     = errors.New("machine id is required")
+	ErrInvalidWaitState      = errors.New("state must be one of started/stopped/suspended/destroyed")
+	ErrSignalRequired        = errors.New("signal is required")
+	ErrConfigRequired        = errors.New("machine config is required")
+	ErrCommandRequired       = errors.New("command is required")
+	ErrMetadataKeyRequired   = errors.New("metadata key is required")
+	ErrInvalidMetadataTarget = errors.New("metadata target must be a non-nil struct pointer")
+	ErrVolumeIDRequired      = errors.New("volume id is required")
+	ErrVolumeNameRequired    = errors.New("volume name is required")
+	ErrVolumeSizeRequired    = errors.New("volume size must be greater than zero")
+	ErrRegionRequired        = errors.New("region is required")
+	ErrOrgSlugRequired       = errors.New("organization slug is required")
+	ErrSecretsRequired       = errors.New("at least one secret is required")
+	ErrSecretNameRequired    = errors.New("secret name is required")
+	ErrInvalidIPAddressType  = errors.New("ip address type must be one of v4/shared_v4/v6/private_v6")
+	ErrIPAddressRequired     = errors.New("ip address is required")
+	ErrHostnameRequired      = errors.New("hostname is required")
+	ErrLeaseHeld             = errors.New("machine lease is held by someone else")
 )
+
+// API error classes, matched by APIError with errors.Is
+var (
+	ErrNotFound           = errors.New("resource not found")
+	ErrConflict           = errors.New("resource conflict")
+	ErrRateLimited        = errors.New("rate limit exceeded")
+	ErrPreconditionFailed = errors.New("precondition failed")
+	ErrValidation         = errors.New("invalid request")
+	ErrServerError        = errors.New("server error")
+)
+
+// IsNotFound returns true if the API reported the resource does not exist
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+// IsRetryable returns true if the call failed due to a transient condition and
+// could succeed if retried. Mutating calls might have been applied regardless.
+func IsRetryable(err error) bool {
+	return errors.Is(err, ErrRateLimited) || errors.Is(err, ErrServerError) || isDialError(err)
+}
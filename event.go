@@ -5,10 +5,32 @@ import (
 	"time"
 )
 
+type EventType string
+
+const (
+	EventTypeLaunch  EventType = "launch"
+	EventTypeStart   EventType = "start"
+	EventTypeStop    EventType = "stop"
+	EventTypeExit    EventType = "exit"
+	EventTypeRestart EventType = "restart"
+	EventTypeUpdate  EventType = "update"
+	EventTypeDestroy EventType = "destroy"
+)
+
+type EventStatus string
+
+const (
+	EventStatusCreated   EventStatus = "created"
+	EventStatusStarted   EventStatus = "started"
+	EventStatusStopped   EventStatus = "stopped"
+	EventStatusReplaced  EventStatus = "replaced"
+	EventStatusDestroyed EventStatus = "destroyed"
+)
+
 type Event struct {
 	ID        string        `json:"id"`
-	Type      string        `json:"type"`
-	Status    string        `json:"status"`
+	Type      EventType     `json:"type"`
+	Status    EventStatus   `json:"status"`
 	Request   *EventRequest `json:"request"`
 	Source    string        `json:"source"`
 	Timestamp int64         `json:"timestamp"`
@@ -29,6 +51,19 @@ type ExitEvent struct {
 	Signal        int       `json:"signal,omitempty"`
 }
 
+// Time returns the event timestamp, which is reported in milliseconds
+func (e Event) Time() time.Time {
+	return time.UnixMilli(e.Timestamp)
+}
+
+// ExitEvent returns exit details if the event has any
+func (e Event) ExitEvent() *ExitEvent {
+	if e.Request == nil {
+		return nil
+	}
+	return e.Request.ExitEvent
+}
+
 func (e Event) Inspect() string {
 	return fmt.Sprintf("event(id=%q type=%q status=%q source=%q ts=%d)",
 		e.ID,
@@ -38,3 +73,56 @@ func (e Event) Inspect() string {
 		e.Timestamp,
 	)
 }
+
+// Events is a list of machine events, as returned by the API in no particular order
+type Events []Event
+
+// Last returns the most recent event
+func (list Events) Last() *Event {
+	var last *Event
+	for i := range list {
+		if last == nil || list[i].Timestamp > last.Timestamp {
+			last = &list[i]
+		}
+	}
+	return last
+}
+
+// LastExit returns the exit details of the most recent exit event
+func (list Events) LastExit() *ExitEvent {
+	var last *Event
+	for i, e := range list {
+		if e.Type != EventTypeExit || e.ExitEvent() == nil {
+			continue
+		}
+		if last == nil || e.Timestamp > last.Timestamp {
+			last = &list[i]
+		}
+	}
+	if last == nil {
+		return nil
+	}
+	return last.ExitEvent()
+}
+
+// OfType returns events of the given type
+func (list Events) OfType(kind EventType) Events {
+	result := Events{}
+	for _, e := range list {
+		if e.Type == kind {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// Since returns events that happened at or after the given time
+func (list Events) Since(t time.Time) Events {
+	result := Events{}
+	for _, e := range list {
+		if !e.Time().Before(t) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
@@ -0,0 +1,35 @@
+package machines_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	machines "github.com/sosedoff/fly-machines"
+)
+
+func TestEvents(t *testing.T) {
+	events := machines.Events{
+		{Type: machines.EventTypeLaunch, Status: machines.EventStatusCreated, Timestamp: 1679458063702},
+		{
+			Type:      machines.EventTypeExit,
+			Status:    machines.EventStatusStopped,
+			Timestamp: 1679458081622,
+			Request:   &machines.EventRequest{ExitEvent: &machines.ExitEvent{ExitCode: 1}},
+		},
+		{Type: machines.EventTypeStart, Status: machines.EventStatusStarted, Timestamp: 1679458064590},
+		{Type: machines.EventTypeExit, Status: machines.EventStatusStopped, Timestamp: 1679458090000},
+	}
+
+	require.Equal(t, time.Date(2023, 3, 22, 4, 7, 43, 702000000, time.UTC), events[0].Time().UTC())
+	require.Equal(t, int64(1679458090000), events.Last().Timestamp)
+	require.Equal(t, 2, len(events.OfType(machines.EventTypeExit)))
+	require.Equal(t, &machines.ExitEvent{ExitCode: 1}, events.LastExit())
+	require.Nil(t, events[:1].LastExit())
+	require.Nil(t, machines.Events{}.Last())
+
+	since := events.Since(time.UnixMilli(1679458064590))
+	require.Equal(t, 3, len(since))
+	require.Equal(t, machines.EventTypeExit, since[0].Type)
+}
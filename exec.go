@@ -0,0 +1,23 @@
+package machines
+
+import (
+	"fmt"
+)
+
+// ExecResult contains the output of the command executed inside the machine
+type ExecResult struct {
+	ExitCode   int    `json:"exit_code"`
+	ExitSignal int    `json:"exit_signal"`
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"`
+}
+
+// ExitError is returned when the command exits with non-zero code
+type ExitError struct {
+	MachineID string
+	Result    *ExecResult
+}
+
+func (err ExitError) Error() string {
+	return fmt.Sprintf("command exited with code %d on machine %s", err.Result.ExitCode, err.MachineID)
+}
@@ -1,33 +1,111 @@
 package machines
 
 import (
+	"encoding/json"
+	"math"
+	"net/url"
+	"strings"
 	"time"
 )
 
 type ListInput struct {
-	State State
+	AppName        string            // Override client's app name
+	State          State             // Only include machines in given state
+	Region         string            // Only include machines in given region
+	NamePrefix     string            // Only include machines with name starting with prefix
+	Metadata       map[string]string // Only include machines with all matching metadata values
+	IncludeDeleted bool              // Include destroyed machines, implied by destroying and destroyed State
+}
+
+// Matches returns true if the machine satisfies all of the filters
+func (i ListInput) Matches(m Machine) bool {
+	if i.State != "" && m.State != i.State {
+		return false
+	}
+	if i.Region != "" && m.Region != i.Region {
+		return false
+	}
+	if i.NamePrefix != "" && !strings.HasPrefix(m.Name, i.NamePrefix) {
+		return false
+	}
+	for k, v := range i.Metadata {
+		if val, ok := m.Config.Metadata[k]; !ok || val != v {
+			return false
+		}
+	}
+	return true
+}
+
+// query returns filters supported by the API
+func (i ListInput) query() url.Values {
+	q := url.Values{}
+
+	// Destroyed machines are only listed by the API when requested
+	if i.IncludeDeleted || i.State == StateDestroying || i.State == StateDestroyed {
+		q.Add("include_deleted", "true")
+	}
+	if i.Region != "" {
+		q.Add("region", i.Region)
+	}
+	for k, v := range i.Metadata {
+		q.Add("metadata."+k, v)
+	}
+
+	return q
 }
 
 type GetInput struct {
-	ID string
+	ID      string
+	AppName string
 }
 
 type CreateInput struct {
+	AppName string `json:"-"`
+
 	Name   string  `json:"name,omitempty"`
 	Region string  `json:"region,omitempty"`
 	Config *Config `json:"config"`
 	Size   Size    `json:"size,omitempty"`
 }
 
+type UpdateInput struct {
+	ID      string `json:"-"`
+	AppName string `json:"-"`
+
+	Name   string  `json:"name,omitempty"`
+	Region string  `json:"region,omitempty"`
+	Config *Config `json:"config"`
+
+	// SkipLaunch updates the config without starting the machine
+	SkipLaunch bool `json:"skip_launch,omitempty"`
+
+	// CurrentVersion is the machine instance ID the update is based on
+	CurrentVersion string `json:"current_version,omitempty"`
+
+	// LeaseNonce is required when the machine is leased
+	LeaseNonce string `json:"-"`
+}
+
+func (i UpdateInput) Validate() error {
+	if i.ID == "" {
+		return ErrMachineIDRequired
+	}
+	if i.Config == nil {
+		return ErrConfigRequired
+	}
+	return nil
+}
+
 type CreateGroupInput struct {
 	Input *CreateInput
 	Count int
 }
 
 type StopInput struct {
-	ID      string        `json:"id,omitempty"`
-	Signal  int           `json:"signal,omitempty"`
-	Timeout time.Duration `json:"timeout,omitempty"`
+	ID      string
+	AppName string
+	Signal  int
+	Timeout time.Duration
 }
 
 func (i StopInput) Validate() error {
@@ -37,6 +115,91 @@ func (i StopInput) Validate() error {
 	return nil
 }
 
+// MarshalJSON encodes the stop request body with signal name and timeout
+// duration string (e.g. "30s") as expected by the API
+func (i StopInput) MarshalJSON() ([]byte, error) {
+	body := struct {
+		Signal  string `json:"signal,omitempty"`
+		Timeout string `json:"timeout,omitempty"`
+	}{}
+
+	if i.Signal > 0 {
+		body.Signal = signalName(i.Signal)
+	}
+	if i.Timeout > 0 {
+		body.Timeout = i.Timeout.String()
+	}
+
+	return json.Marshal(body)
+}
+
+type StartInput struct {
+	ID      string
+	AppName string
+}
+
+func (i StartInput) Validate() error {
+	if i.ID == "" {
+		return ErrMachineIDRequired
+	}
+	return nil
+}
+
+type RestartInput struct {
+	ID        string
+	AppName   string
+	Signal    int
+	Timeout   time.Duration
+	ForceStop bool
+}
+
+func (i RestartInput) Validate() error {
+	if i.ID == "" {
+		return ErrMachineIDRequired
+	}
+	return nil
+}
+
+type SignalInput struct {
+	ID      string
+	AppName string
+	Signal  int
+}
+
+func (i SignalInput) Validate() error {
+	if i.ID == "" {
+		return ErrMachineIDRequired
+	}
+	if i.Signal <= 0 {
+		return ErrSignalRequired
+	}
+	return nil
+}
+
+type CordonInput struct {
+	ID      string
+	AppName string
+}
+
+func (i CordonInput) Validate() error {
+	if i.ID == "" {
+		return ErrMachineIDRequired
+	}
+	return nil
+}
+
+type SuspendInput struct {
+	ID      string
+	AppName string
+}
+
+func (i SuspendInput) Validate() error {
+	if i.ID == "" {
+		return ErrMachineIDRequired
+	}
+	return nil
+}
+
 type DeleteInput struct {
 	ID      string
 	AppName string
@@ -50,6 +213,60 @@ func (i DeleteInput) Validate() error {
 	return nil
 }
 
+type ExecInput struct {
+	ID            string
+	AppName       string
+	Command       []string      // Command and its arguments
+	Stdin         string        // Optional input passed to the command
+	Timeout       time.Duration // Command timeout, rounded up to whole seconds
+	CheckExitCode bool          // Return ExitError when command exits with non-zero code
+}
+
+func (i ExecInput) Validate() error {
+	if i.ID == "" {
+		return ErrMachineIDRequired
+	}
+	if len(i.Command) == 0 {
+		return ErrCommandRequired
+	}
+	return nil
+}
+
+// MarshalJSON encodes the exec request body with timeout in seconds. Sub-second
+// timeouts are rounded up so they are not sent as zero.
+func (i ExecInput) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Command []string `json:"command"`
+		Stdin   string   `json:"stdin,omitempty"`
+		Timeout int      `json:"timeout,omitempty"`
+	}{
+		Command: i.Command,
+		Stdin:   i.Stdin,
+		Timeout: int(math.Ceil(i.Timeout.Seconds())),
+	})
+}
+
+type MetadataInput struct {
+	ID      string
+	AppName string
+	Key     string
+	Value   string
+}
+
+func (i MetadataInput) Validate() error {
+	if i.ID == "" {
+		return ErrMachineIDRequired
+	}
+	if i.Key == "" {
+		return ErrMetadataKeyRequired
+	}
+	return nil
+}
+
+func (i MetadataInput) path() string {
+	return "/machines/" + i.ID + "/metadata/" + url.PathEscape(i.Key)
+}
+
 type WaitInput struct {
 	ID         string
 	AppName    string
@@ -64,7 +281,7 @@ func (i WaitInput) Validate() error {
 	}
 
 	switch i.State {
-	case StateStarted, StateStopped, StateDestroyed:
+	case StateStarted, StateStopped, StateSuspended, StateDestroyed:
 		return nil
 	default:
 		return ErrInvalidWaitState
@@ -72,9 +289,10 @@ func (i WaitInput) Validate() error {
 }
 
 type LeaseInput struct {
-	ID    string `json:"-"`
-	Nonce string `json:"-"`
-	TTL   int    `json:"ttl,omitempty"`
+	ID      string `json:"-"`
+	AppName string `json:"-"`
+	Nonce   string `json:"-"`
+	TTL     int    `json:"ttl,omitempty"`
 }
 
 func (i LeaseInput) Validate() error {
@@ -83,3 +301,241 @@ func (i LeaseInput) Validate() error {
 	}
 	return nil
 }
+
+type LeaseManagerInput struct {
+	ID      string
+	AppName string
+	TTL     int // Lease TTL in seconds
+
+	RetryAttempts int           // Max number of attempts to acquire the lease
+	RetryDelay    time.Duration // Initial delay between attempts to acquire or renew the lease, doubled after each one
+	MaxRetryDelay time.Duration // Upper limit for the delay between attempts
+	RenewInterval time.Duration // Delay between renewals, derived from lease expiration if not set
+}
+
+func (i LeaseManagerInput) Validate() error {
+	if i.ID == "" {
+		return ErrMachineIDRequired
+	}
+	return nil
+}
+
+func (i LeaseManagerInput) withDefaults() LeaseManagerInput {
+	if i.TTL <= 0 {
+		i.TTL = defaultLeaseTTL
+	}
+	if i.RetryAttempts <= 0 {
+		i.RetryAttempts = defaultLeaseRetryAttempts
+	}
+	if i.RetryDelay <= 0 {
+		i.RetryDelay = defaultLeaseRetryDelay
+	}
+	if i.MaxRetryDelay <= 0 {
+		i.MaxRetryDelay = defaultLeaseMaxRetryDelay
+	}
+	return i
+}
+
+type ListVolumesInput struct {
+	AppName string
+}
+
+type CreateVolumeInput struct {
+	AppName string `json:"-"`
+
+	Name              string `json:"name"`
+	Region            string `json:"region"`
+	SizeGB            int    `json:"size_gb"`
+	Encrypted         *bool  `json:"encrypted,omitempty"`
+	SnapshotID        string `json:"snapshot_id,omitempty"`
+	SnapshotRetention int    `json:"snapshot_retention,omitempty"`
+	RequireUniqueZone *bool  `json:"require_unique_zone,omitempty"`
+}
+
+func (i CreateVolumeInput) Validate() error {
+	if i.Name == "" {
+		return ErrVolumeNameRequired
+	}
+	if i.Region == "" {
+		return ErrRegionRequired
+	}
+	if i.SizeGB <= 0 {
+		return ErrVolumeSizeRequired
+	}
+	return nil
+}
+
+type VolumeInput struct {
+	ID      string
+	AppName string
+}
+
+func (i VolumeInput) Validate() error {
+	if i.ID == "" {
+		return ErrVolumeIDRequired
+	}
+	return nil
+}
+
+type ExtendVolumeInput struct {
+	ID      string `json:"-"`
+	AppName string `json:"-"`
+	SizeGB  int    `json:"size_gb"`
+}
+
+func (i ExtendVolumeInput) Validate() error {
+	if i.ID == "" {
+		return ErrVolumeIDRequired
+	}
+	if i.SizeGB <= 0 {
+		return ErrVolumeSizeRequired
+	}
+	return nil
+}
+
+type ForkVolumeInput struct {
+	ID      string `json:"source_volume_id"` // Source volume ID
+	AppName string `json:"-"`
+
+	Name              string `json:"name,omitempty"`
+	Region            string `json:"region,omitempty"`
+	RequireUniqueZone *bool  `json:"require_unique_zone,omitempty"`
+}
+
+func (i ForkVolumeInput) Validate() error {
+	if i.ID == "" {
+		return ErrVolumeIDRequired
+	}
+	return nil
+}
+
+type ListAppsInput struct {
+	OrgSlug string
+}
+
+func (i ListAppsInput) Validate() error {
+	if i.OrgSlug == "" {
+		return ErrOrgSlugRequired
+	}
+	return nil
+}
+
+type CreateAppInput struct {
+	Name             string `json:"app_name"`
+	OrgSlug          string `json:"org_slug"`
+	Network          string `json:"network,omitempty"`
+	EnableSubdomains bool   `json:"enable_subdomains,omitempty"`
+}
+
+func (i CreateAppInput) Validate() error {
+	if i.Name == "" {
+		return ErrAppNameRequired
+	}
+	if i.OrgSlug == "" {
+		return ErrOrgSlugRequired
+	}
+	return nil
+}
+
+type AppInput struct {
+	Name string
+}
+
+func (i AppInput) Validate() error {
+	if i.Name == "" {
+		return ErrAppNameRequired
+	}
+	return nil
+}
+
+type ListSecretsInput struct {
+	AppName string
+}
+
+type SetSecretsInput struct {
+	AppName string            `json:"-"`
+	Values  map[string]string `json:"values"`
+}
+
+func (i SetSecretsInput) Validate() error {
+	if len(i.Values) == 0 {
+		return ErrSecretsRequired
+	}
+	for name := range i.Values {
+		if name == "" {
+			return ErrSecretNameRequired
+		}
+	}
+	return nil
+}
+
+type UnsetSecretsInput struct {
+	AppName string
+	Names   []string
+}
+
+func (i UnsetSecretsInput) Validate() error {
+	if len(i.Names) == 0 {
+		return ErrSecretsRequired
+	}
+	for _, name := range i.Names {
+		if name == "" {
+			return ErrSecretNameRequired
+		}
+	}
+	return nil
+}
+
+type ListIPAddressesInput struct {
+	AppName string
+}
+
+type AllocateIPAddressInput struct {
+	AppName string `json:"-"`
+
+	Type        IPAddressType `json:"type"`
+	Region      string        `json:"region,omitempty"`       // Dedicated IPs could be limited to the region
+	Network     string        `json:"network,omitempty"`      // Network name for private IPs
+	ServiceName string        `json:"service_name,omitempty"` // Service to route the private IP to
+}
+
+func (i AllocateIPAddressInput) Validate() error {
+	switch i.Type {
+	case IPAddressTypeV4, IPAddressTypeSharedV4, IPAddressTypeV6, IPAddressTypePrivateV6:
+		return nil
+	default:
+		return ErrInvalidIPAddressType
+	}
+}
+
+type ReleaseIPAddressInput struct {
+	AppName string
+	IP      string
+}
+
+func (i ReleaseIPAddressInput) Validate() error {
+	if i.IP == "" {
+		return ErrIPAddressRequired
+	}
+	return nil
+}
+
+type ListCertificatesInput struct {
+	AppName string
+}
+
+type CertificateInput struct {
+	AppName  string `json:"-"`
+	Hostname string `json:"hostname"`
+}
+
+func (i CertificateInput) Validate() error {
+	if i.Hostname == "" {
+		return ErrHostnameRequired
+	}
+	return nil
+}
+
+func (i CertificateInput) path() string {
+	return "/certificates/" + url.PathEscape(i.Hostname)
+}
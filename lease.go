@@ -1,7 +1,22 @@
 package machines
 
+import (
+	"strings"
+)
+
 type Lease struct {
+	MachineID string `json:"-"`
 	Nonce     string `json:"nonce"`
 	ExpiresAt int64  `json:"expires_at"`
 	Owner     string `json:"owner"`
 }
+
+// coversPath returns true if the request path targets the leased machine
+func (l *Lease) coversPath(path string) bool {
+	if l == nil || l.MachineID == "" || l.Nonce == "" {
+		return false
+	}
+
+	prefix := "/machines/" + l.MachineID
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
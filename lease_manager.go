@@ -0,0 +1,241 @@
+package machines
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLeaseTTL           = 30
+	defaultLeaseRetryAttempts = 10
+	defaultLeaseRetryDelay    = time.Second
+	defaultLeaseMaxRetryDelay = 30 * time.Second
+)
+
+// LeaseManager holds a machine lease and keeps it alive in the background.
+// It can be used as a distributed lock between processes working on the same machine.
+type LeaseManager struct {
+	client *Client
+	input  LeaseManagerInput
+	lease  *Lease
+	err    error
+	mu     sync.Mutex
+
+	closeOnce sync.Once
+	closeErr  error
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// AcquireLease obtains the machine lease, retrying with backoff while someone
+// else holds it, and starts renewing the lease until Close is called.
+func (c *Client) AcquireLease(ctx context.Context, input *LeaseManagerInput) (*LeaseManager, error) {
+	if input == nil {
+		return nil, ErrInputRequired
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	m := &LeaseManager{
+		client: c,
+		input:  input.withDefaults(),
+		done:   make(chan struct{}),
+	}
+
+	lease, err := m.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m.lease = lease
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+
+	go m.renew()
+
+	return m, nil
+}
+
+// Lease returns the currently held lease
+func (m *LeaseManager) Lease() Lease {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return *m.lease
+}
+
+// Client returns a lease-scoped client for the machine
+func (m *LeaseManager) Client() *Client {
+	client := m.client
+	if m.input.AppName != "" {
+		client = client.WithApp(&App{Name: m.input.AppName})
+	}
+
+	lease := m.Lease()
+	return client.WithLease(&lease)
+}
+
+// Context returns a context that is cancelled once the lease is lost or released
+func (m *LeaseManager) Context() context.Context {
+	return m.ctx
+}
+
+// Err returns the error that caused lease renewal to fail
+func (m *LeaseManager) Err() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.err
+}
+
+// Close stops the lease renewal and releases the lease. Subsequent calls do
+// nothing and return the result of the first call.
+func (m *LeaseManager) Close(ctx context.Context) error {
+	m.closeOnce.Do(func() {
+		m.closeErr = m.close(ctx)
+	})
+	return m.closeErr
+}
+
+func (m *LeaseManager) close(ctx context.Context) error {
+	m.cancel()
+	<-m.done
+
+	// Lease is already lost, nothing to release
+	if err := m.Err(); err != nil {
+		return err
+	}
+
+	lease := m.Lease()
+	return m.client.ReleaseLeaseContext(ctx, &LeaseInput{
+		ID:      lease.MachineID,
+		AppName: m.input.AppName,
+		Nonce:   lease.Nonce,
+	})
+}
+
+func (m *LeaseManager) acquire(ctx context.Context) (*Lease, error) {
+	delay := m.input.RetryDelay
+
+	for attempt := 1; ; attempt++ {
+		lease, err := m.client.LeaseContext(ctx, &LeaseInput{
+			ID:      m.input.ID,
+			AppName: m.input.AppName,
+			TTL:     m.input.TTL,
+		})
+		if err == nil {
+			return lease, nil
+		}
+		if !errors.Is(err, ErrLeaseHeld) || attempt >= m.input.RetryAttempts {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > m.input.MaxRetryDelay {
+			delay = m.input.MaxRetryDelay
+		}
+	}
+}
+
+func (m *LeaseManager) renew() {
+	defer close(m.done)
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-time.After(m.renewInterval()):
+		}
+
+		lease, err := m.extend()
+		if err != nil {
+			if m.ctx.Err() != nil {
+				return
+			}
+
+			m.mu.Lock()
+			m.err = err
+			m.mu.Unlock()
+
+			m.cancel()
+			return
+		}
+
+		m.mu.Lock()
+		m.lease = lease
+		m.mu.Unlock()
+	}
+}
+
+// extend renews the lease, retrying transient failures with backoff until the
+// current lease expires
+func (m *LeaseManager) extend() (*Lease, error) {
+	current := m.Lease()
+	expiresAt := time.Unix(current.ExpiresAt, 0)
+	if current.ExpiresAt == 0 {
+		expiresAt = time.Now().Add(time.Duration(m.input.TTL) * time.Second)
+	}
+	delay := m.input.RetryDelay
+
+	for {
+		lease, err := m.client.LeaseContext(m.ctx, &LeaseInput{
+			ID:      current.MachineID,
+			AppName: m.input.AppName,
+			Nonce:   current.Nonce,
+			TTL:     m.input.TTL,
+		})
+		if err == nil || !isTransientLeaseError(err) {
+			return lease, err
+		}
+
+		remaining := time.Until(expiresAt)
+		if remaining <= 0 {
+			return nil, err
+		}
+		if delay > remaining {
+			delay = remaining
+		}
+
+		select {
+		case <-m.ctx.Done():
+			return nil, m.ctx.Err()
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > m.input.MaxRetryDelay {
+			delay = m.input.MaxRetryDelay
+		}
+	}
+}
+
+// isTransientLeaseError reports whether the lease renewal might succeed when
+// retried. API errors other than server errors and rate limits are final.
+func isTransientLeaseError(err error) bool {
+	var apiErr APIError
+	return !errors.As(err, &apiErr) || IsRetryable(err)
+}
+
+// renewInterval returns the delay before the next renewal, which is half of the
+// remaining lease time or half of the TTL if expiration time is unknown
+func (m *LeaseManager) renewInterval() time.Duration {
+	if m.input.RenewInterval > 0 {
+		return m.input.RenewInterval
+	}
+
+	remaining := time.Until(time.Unix(m.Lease().ExpiresAt, 0))
+	if remaining <= 0 || remaining > time.Duration(m.input.TTL)*time.Second {
+		remaining = time.Duration(m.input.TTL) * time.Second
+	}
+
+	return remaining / 2
+}
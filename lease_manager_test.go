@@ -0,0 +1,110 @@
+package machines_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	machines "github.com/sosedoff/fly-machines"
+	"github.com/sosedoff/fly-machines/machinestest"
+	"github.com/sosedoff/fly-machines/testdata"
+)
+
+func TestAcquireLease(t *testing.T) {
+	_, err := client.AcquireLease(context.Background(), nil)
+	require.Equal(t, machines.ErrInputRequired, err)
+
+	_, err = client.AcquireLease(context.Background(), &machines.LeaseManagerInput{})
+	require.Equal(t, machines.ErrMachineIDRequired, err)
+
+	_, err = client.AcquireLease(context.Background(), &machines.LeaseManagerInput{ID: "foo"})
+	require.Equal(t, "machine does not exist", err.Error())
+
+	_, err = client.AcquireLease(context.Background(), &machines.LeaseManagerInput{
+		ID:            "leased",
+		RetryAttempts: 3,
+		RetryDelay:    time.Millisecond,
+	})
+	require.ErrorIs(t, err, machines.ErrLeaseHeld)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = client.AcquireLease(ctx, &machines.LeaseManagerInput{ID: "leased", RetryDelay: time.Second})
+	require.Equal(t, context.DeadlineExceeded, err)
+
+	manager, err := client.AcquireLease(context.Background(), &machines.LeaseManagerInput{
+		ID:            "1",
+		RenewInterval: 10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "1234", manager.Lease().Nonce)
+	require.Equal(t, "1", manager.Client().GetLease().MachineID)
+
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, manager.Context().Err())
+	require.NoError(t, manager.Err())
+
+	require.NoError(t, manager.Close(context.Background()))
+	require.Equal(t, context.Canceled, manager.Context().Err())
+}
+
+func TestAcquireLeaseRenewalFailure(t *testing.T) {
+	srv := testdata.Server("app")
+	client := testClient(srv.URL)
+
+	manager, err := client.AcquireLease(context.Background(), &machines.LeaseManagerInput{
+		ID:            "1",
+		RenewInterval: 10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	srv.Close()
+
+	select {
+	case <-manager.Context().Done():
+	case <-time.After(time.Second):
+		t.Fatal("lease context was not cancelled")
+	}
+
+	require.Error(t, manager.Err())
+	require.Equal(t, manager.Err(), manager.Close(context.Background()))
+}
+
+func TestAcquireLeaseRenewalRetry(t *testing.T) {
+	srv := machinestest.New()
+	defer srv.Close()
+
+	client := srv.Client("app")
+	ctx := context.Background()
+
+	machine, err := srv.Client("other").CreateContext(ctx, &machines.CreateInput{Config: &machines.Config{}})
+	require.NoError(t, err)
+
+	manager, err := client.AcquireLease(ctx, &machines.LeaseManagerInput{
+		ID:            machine.ID,
+		AppName:       "other",
+		TTL:           60,
+		RetryDelay:    time.Millisecond,
+		RenewInterval: 10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	// Lease-scoped client talks to the lease app
+	leased, err := manager.Client().GetContext(ctx, &machines.GetInput{ID: machine.ID})
+	require.NoError(t, err)
+	require.Equal(t, machine.ID, leased.ID)
+
+	// Transient failures are retried while the lease is still valid
+	srv.InjectFault(machinestest.Fault{Path: "/apps/*/machines/*/lease", Status: 503, Count: 5})
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, manager.Err())
+	require.NoError(t, manager.Context().Err())
+
+	require.NoError(t, manager.Close(ctx))
+
+	// Lease is not released again with the stale nonce
+	srv.InjectFault(machinestest.Fault{Path: "/apps/*/machines/*/lease", Status: 500})
+	require.NoError(t, manager.Close(ctx))
+}
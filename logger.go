@@ -0,0 +1,178 @@
+package machines
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+)
+
+// LogLevels defines levels of the request log records
+type LogLevels struct {
+	Request slog.Level // Level of successful requests
+	Error   slog.Level // Level of failed requests
+}
+
+// DefaultLogLevels logs successful requests at info level and failures at error level.
+// Request and response bodies are logged when debug level is enabled.
+var DefaultLogLevels = LogLevels{
+	Request: slog.LevelInfo,
+	Error:   slog.LevelError,
+}
+
+// WithLogger logs every API request with the default log levels
+func WithLogger(logger *slog.Logger) Option {
+	return WithLoggerLevels(logger, DefaultLogLevels)
+}
+
+// WithLoggerLevels logs every API request with the given log levels.
+// Authorization header and known secret values are never logged.
+func WithLoggerLevels(logger *slog.Logger, levels LogLevels) Option {
+	return func(c *Client) {
+		l := &requestLogger{logger: logger, levels: levels, secrets: c.secrets}
+		c.hooks = append(c.hooks, Middleware{
+			BeforeRequest: l.beforeRequest,
+			AfterResponse: l.afterResponse,
+			OnError:       l.onError,
+		})
+	}
+}
+
+type requestLogger struct {
+	logger  *slog.Logger
+	levels  LogLevels
+	secrets *redactor
+}
+
+func (l *requestLogger) beforeRequest(call *Call) error {
+	ctx := call.Request.Context()
+	if !l.logger.Enabled(ctx, slog.LevelDebug) {
+		return nil
+	}
+
+	header := call.Request.Header.Clone()
+	if header.Get("Authorization") != "" {
+		header.Set("Authorization", RedactedValue)
+	}
+
+	attrs := append(l.callAttrs(call), slog.Any("header", header))
+	if call.Request.GetBody != nil {
+		body, err := call.Request.GetBody()
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		attrs = append(attrs, slog.String("body", l.redactBody(data)))
+	}
+
+	l.logger.LogAttrs(ctx, slog.LevelDebug, "fly api request", attrs...)
+	return nil
+}
+
+func (l *requestLogger) afterResponse(call *Call, resp *http.Response) {
+	ctx := call.Request.Context()
+	requestID := resp.Header.Get(requestIDHeader)
+
+	if l.logger.Enabled(ctx, slog.LevelDebug) {
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(io.MultiReader(bytes.NewReader(data), errReader{err}))
+
+		l.logger.LogAttrs(ctx, slog.LevelDebug, "fly api response",
+			append(l.callAttrs(call),
+				slog.String("request_id", requestID),
+				slog.String("body", l.redactBody(data)),
+			)...,
+		)
+	}
+
+	// Failed responses are logged by onError
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return
+	}
+
+	l.logger.LogAttrs(ctx, l.levels.Request, "fly api call",
+		append(l.callAttrs(call), slog.String("request_id", requestID))...,
+	)
+}
+
+func (l *requestLogger) onError(call *Call, err error) {
+	attrs := l.callAttrs(call)
+
+	var apiErr APIError
+	if errors.As(err, &apiErr) {
+		attrs = append(attrs, slog.String("request_id", apiErr.RequestID()))
+	}
+	attrs = append(attrs, slog.String("error", l.secrets.redact(err.Error())))
+
+	l.logger.LogAttrs(call.Request.Context(), l.levels.Error, "fly api call failed", attrs...)
+}
+
+// redactBody redacts known secret values and env vars backed by machine secrets
+func (l *requestLogger) redactBody(data []byte) string {
+	var body any
+	if err := json.Unmarshal(data, &body); err == nil && redactConfigEnv(body) {
+		if redacted, err := json.Marshal(body); err == nil {
+			data = redacted
+		}
+	}
+	return l.secrets.redact(string(data))
+}
+
+// redactConfigEnv replaces env of machine configs found in the decoded JSON
+// value with Config.RedactedEnv, and reports whether any config was found
+func redactConfigEnv(val any) bool {
+	found := false
+
+	switch v := val.(type) {
+	case []any:
+		for _, item := range v {
+			found = redactConfigEnv(item) || found
+		}
+	case map[string]any:
+		_, hasEnv := v["env"].(map[string]any)
+		_, hasSecrets := v["secrets"].([]any)
+		if hasEnv && hasSecrets {
+			if data, err := json.Marshal(v); err == nil {
+				var config Config
+				if json.Unmarshal(data, &config) == nil {
+					v["env"] = config.RedactedEnv()
+					found = true
+				}
+			}
+		}
+		for _, item := range v {
+			found = redactConfigEnv(item) || found
+		}
+	}
+
+	return found
+}
+
+func (l *requestLogger) callAttrs(call *Call) []slog.Attr {
+	return []slog.Attr{
+		slog.String("method", call.Request.Method),
+		slog.String("path", call.Request.URL.Path),
+		slog.String("app", call.AppName),
+		slog.String("machine_id", call.MachineID),
+		slog.Int("status", call.StatusCode),
+		slog.Duration("latency", call.Duration),
+	}
+}
+
+// errReader returns the error after the buffered body is consumed
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	return 0, io.EOF
+}
@@ -14,10 +14,25 @@ type Machine struct {
 	CreatedAt  string   `json:"created_at"`
 	UpdatedAt  string   `json:"updated_at"`
 	ImageRef   ImageRef `json:"image_ref"`
-	Events     []Event  `json:"events"`
+	Events     Events   `json:"events"`
 	Config     Config   `json:"config"`
 }
 
+// StartResult is returned by the start call
+type StartResult struct {
+	ID            string `json:"-"`
+	AppName       string `json:"-"`
+	InstanceID    string `json:"instance_id"` // Instance of the started machine
+	PreviousState State  `json:"previous_state"`
+	Migrated      bool   `json:"migrated"`
+	NewHost       string `json:"new_host"`
+}
+
+// WaitInput returns the input for waiting on the machine to become started
+func (r StartResult) WaitInput() *WaitInput {
+	return &WaitInput{ID: r.ID, AppName: r.AppName, InstanceID: r.InstanceID, State: StateStarted}
+}
+
 type ImageRef struct {
 	Registry   string `json:"registry"`
 	Repository string `json:"repository"`
@@ -27,16 +42,20 @@ type ImageRef struct {
 
 func (m Machine) CanStop() bool {
 	switch m.State {
-	case StateStarting, StateStarted:
+	case StateStarting, StateStarted, StateSuspended:
 		return true
 	default:
 		return false
 	}
 }
 
+func (m Machine) CanSuspend() bool {
+	return m.State == StateStarted
+}
+
 func (m Machine) CanDelete() bool {
 	switch m.State {
-	case StateStarting, StateStarted, StateStopping, StateStopped:
+	case StateStarting, StateStarted, StateStopping, StateStopped, StateSuspending, StateSuspended:
 		return true
 	default:
 		return false
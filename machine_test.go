@@ -0,0 +1,34 @@
+package machines_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	machines "github.com/sosedoff/fly-machines"
+)
+
+func TestMachineStateChecks(t *testing.T) {
+	examples := []struct {
+		state      machines.State
+		canStop    bool
+		canSuspend bool
+		canDelete  bool
+	}{
+		{machines.StateCreated, false, false, false},
+		{machines.StateStarting, true, false, true},
+		{machines.StateStarted, true, true, true},
+		{machines.StateStopping, false, false, true},
+		{machines.StateStopped, false, false, true},
+		{machines.StateSuspending, false, false, true},
+		{machines.StateSuspended, true, false, true},
+		{machines.StateDestroyed, false, false, false},
+	}
+
+	for _, ex := range examples {
+		machine := machines.Machine{State: ex.state}
+		require.Equal(t, ex.canStop, machine.CanStop(), ex.state)
+		require.Equal(t, ex.canSuspend, machine.CanSuspend(), ex.state)
+		require.Equal(t, ex.canDelete, machine.CanDelete(), ex.state)
+	}
+}
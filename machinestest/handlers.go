@@ -0,0 +1,433 @@
+package machinestest
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	machines "github.com/sosedoff/fly-machines"
+)
+
+// waitPollInterval is how often the wait request checks the machine state
+const waitPollInterval = 5 * time.Millisecond
+
+func (s *Server) listMachines(c *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	metadata := map[string]string{}
+	for key, values := range c.Request.URL.Query() {
+		if name, ok := strings.CutPrefix(key, "metadata."); ok {
+			metadata[name] = values[0]
+		}
+	}
+	includeDeleted := c.Query("include_deleted") == "true"
+
+	now := time.Now()
+	list := []*machine{}
+	for _, m := range s.machines[c.Param("app")] {
+		if m.matches(now, c.Query("region"), includeDeleted, metadata) {
+			list = append(list, m)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].seq < list[j].seq })
+
+	result := make([]machines.Machine, 0, len(list))
+	for _, m := range list {
+		result = append(result, m.snapshot(now))
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (s *Server) createMachine(c *gin.Context) {
+	input := struct {
+		machines.CreateInput
+		SkipLaunch bool `json:"skip_launch"`
+	}{}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		abortWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if input.Config == nil {
+		abortWithError(c, http.StatusBadRequest, "no config provided")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	appName := c.Param("app")
+	if s.machines[appName] == nil {
+		s.machines[appName] = map[string]*machine{}
+	}
+
+	s.seq++
+	if input.Name == "" {
+		input.Name = fmt.Sprintf("machine-%d", s.seq)
+	}
+	for _, m := range s.machines[appName] {
+		if m.data.Name == input.Name && m.state(now) != machines.StateDestroyed {
+			abortWithError(c, http.StatusUnprocessableEntity, "machine name is already taken")
+			return
+		}
+	}
+	if input.Region == "" {
+		input.Region = DefaultRegion
+	}
+
+	m := &machine{
+		seq: s.seq,
+		data: machines.Machine{
+			ID:         randomID(7),
+			Name:       input.Name,
+			Region:     input.Region,
+			InstanceID: newInstanceID(),
+			PrivateIP:  fmt.Sprintf("fdaa:0:1:a7b:1::%x", s.seq),
+			CreatedAt:  now.UTC().Format(time.RFC3339),
+			Config:     *input.Config,
+		},
+	}
+	m.addEvent(now, machines.EventTypeLaunch, machines.EventStatusCreated, nil)
+
+	if input.SkipLaunch {
+		m.transition(now, s.transitionDelay, machines.StateCreated, machines.StateStopped)
+	} else {
+		m.transition(now, s.transitionDelay, machines.StateCreated, machines.StateStarting, machines.StateStarted)
+		m.addEvent(now, machines.EventTypeStart, machines.EventStatusStarted, nil)
+	}
+	s.machines[appName][m.data.ID] = m
+
+	c.JSON(http.StatusOK, m.snapshot(now))
+}
+
+func (s *Server) getMachine(c *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := c.MustGet("machine").(*machine)
+	c.JSON(http.StatusOK, m.snapshot(time.Now()))
+}
+
+func (s *Server) updateMachine(c *gin.Context) {
+	input := machines.UpdateInput{}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		abortWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if input.Config == nil {
+		abortWithError(c, http.StatusBadRequest, "no config provided")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := c.MustGet("machine").(*machine)
+	if input.CurrentVersion != "" && input.CurrentVersion != m.data.InstanceID {
+		abortWithError(c, http.StatusPreconditionFailed, "machine version mismatch")
+		return
+	}
+
+	now := time.Now()
+	m.data.Config = *input.Config
+	m.data.InstanceID = newInstanceID()
+	if input.Name != "" {
+		m.data.Name = input.Name
+	}
+	m.addEvent(now, machines.EventTypeUpdate, machines.EventStatusReplaced, nil)
+
+	if !input.SkipLaunch {
+		m.transition(now, s.transitionDelay, machines.StateReplacing, machines.StateStarting, machines.StateStarted)
+		m.addEvent(now, machines.EventTypeStart, machines.EventStatusStarted, nil)
+	}
+
+	c.JSON(http.StatusOK, m.snapshot(now))
+}
+
+func (s *Server) deleteMachine(c *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := c.MustGet("machine").(*machine)
+	now := time.Now()
+
+	if c.Query("force") != "true" {
+		if state, ok := machineStateIn(m, now, machines.StateCreated, machines.StateStopped, machines.StateSuspended); !ok {
+			abortWithStateError(c, "destroy", state)
+			return
+		}
+	}
+
+	m.transition(now, s.transitionDelay, machines.StateDestroying, machines.StateDestroyed)
+	m.addEvent(now, machines.EventTypeDestroy, machines.EventStatusDestroyed, nil)
+	m.lease = nil
+
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+func (s *Server) startMachine(c *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := c.MustGet("machine").(*machine)
+	now := time.Now()
+
+	state, ok := machineStateIn(m, now, machines.StateCreated, machines.StateStopped, machines.StateSuspended)
+	if !ok {
+		abortWithStateError(c, "start", state)
+		return
+	}
+
+	m.transition(now, s.transitionDelay, machines.StateStarting, machines.StateStarted)
+	m.addEvent(now, machines.EventTypeStart, machines.EventStatusStarted, nil)
+
+	c.JSON(http.StatusOK, machines.StartResult{InstanceID: m.data.InstanceID, PreviousState: state})
+}
+
+func (s *Server) stopMachine(c *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := c.MustGet("machine").(*machine)
+	now := time.Now()
+
+	state, ok := machineStateIn(m, now, machines.StateStarting, machines.StateStarted, machines.StateSuspending, machines.StateSuspended)
+	if !ok {
+		abortWithStateError(c, "stop", state)
+		return
+	}
+
+	m.transition(now, s.transitionDelay, machines.StateStopping, machines.StateStopped)
+	m.addEvent(now, machines.EventTypeExit, machines.EventStatusStopped, &machines.EventRequest{
+		ExitEvent: &machines.ExitEvent{ExitedAt: now.UTC(), RequestedStop: true},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+func (s *Server) restartMachine(c *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := c.MustGet("machine").(*machine)
+	now := time.Now()
+
+	if state, ok := machineStateIn(m, now, machines.StateStarted); !ok {
+		abortWithStateError(c, "restart", state)
+		return
+	}
+
+	m.transition(now, s.transitionDelay, machines.StateStopping, machines.StateStarting, machines.StateStarted)
+	m.addEvent(now, machines.EventTypeRestart, machines.EventStatusStarted, nil)
+
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+func (s *Server) suspendMachine(c *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := c.MustGet("machine").(*machine)
+	now := time.Now()
+
+	if state, ok := machineStateIn(m, now, machines.StateStarted); !ok {
+		abortWithStateError(c, "suspend", state)
+		return
+	}
+
+	m.transition(now, s.transitionDelay, machines.StateSuspending, machines.StateSuspended)
+
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+func (s *Server) signalMachine(c *gin.Context) {
+	input := map[string]string{}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		abortWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !strings.HasPrefix(input["signal"], "SIG") {
+		abortWithError(c, http.StatusBadRequest, "invalid signal")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := c.MustGet("machine").(*machine)
+	if state, ok := machineStateIn(m, time.Now(), machines.StateStarted); !ok {
+		abortWithStateError(c, "signal", state)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+func (s *Server) cordonMachine(c *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c.MustGet("machine").(*machine).cordoned = true
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+func (s *Server) uncordonMachine(c *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := c.MustGet("machine").(*machine)
+	if !m.cordoned {
+		abortWithError(c, http.StatusBadRequest, "machine is not cordoned")
+		return
+	}
+	m.cordoned = false
+
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// waitMachine blocks until the machine reaches the requested state, the
+// timeout expires (408) or the request is canceled
+func (s *Server) waitMachine(c *gin.Context) {
+	state := machines.State(c.Query("state"))
+	switch state {
+	case machines.StateStarted, machines.StateStopped, machines.StateSuspended, machines.StateDestroyed:
+	default:
+		abortWithError(c, http.StatusBadRequest, "invalid state: "+string(state))
+		return
+	}
+
+	ctx, cancel, err := waitContext(c.Request.Context(), c.Query("timeout"))
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, "invalid timeout")
+		return
+	}
+	defer cancel()
+
+	m := c.MustGet("machine").(*machine)
+	ticker := time.NewTicker(waitPollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.mu.Lock()
+		current := m.state(time.Now())
+		s.mu.Unlock()
+
+		if current == state {
+			c.JSON(http.StatusOK, gin.H{"ok": true})
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			abortWithError(c, http.StatusRequestTimeout, fmt.Sprintf("machine did not reach state '%s', current state: '%s'", state, current))
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) listEvents(c *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := c.MustGet("machine").(*machine)
+	c.JSON(http.StatusOK, m.snapshot(time.Now()).Events)
+}
+
+func (s *Server) acquireLease(c *gin.Context) {
+	input := machines.LeaseInput{}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		abortWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ttl := DefaultLeaseTTL
+	if input.TTL > 0 {
+		ttl = time.Duration(input.TTL) * time.Second
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := c.MustGet("machine").(*machine)
+	now := time.Now()
+	nonce := c.GetHeader("fly-machine-lease-nonce")
+
+	lease := m.activeLease(now)
+	switch {
+	case lease == nil:
+		lease = &machines.Lease{Nonce: randomID(8), Owner: "test@machinestest"}
+		m.lease = lease
+	case lease.Nonce != nonce:
+		abortWithError(c, http.StatusConflict, "lease currently held by "+lease.Owner)
+		return
+	}
+	lease.ExpiresAt = now.Add(ttl).Unix()
+
+	c.JSON(http.StatusOK, lease)
+}
+
+func (s *Server) releaseLease(c *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := c.MustGet("machine").(*machine)
+	lease := m.activeLease(time.Now())
+	if lease == nil {
+		abortWithError(c, http.StatusNotFound, "lease not found")
+		return
+	}
+	if lease.Nonce != c.GetHeader("fly-machine-lease-nonce") {
+		abortWithError(c, http.StatusConflict, "lease currently held by "+lease.Owner)
+		return
+	}
+	m.lease = nil
+
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+func (s *Server) getMetadata(c *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := c.MustGet("machine").(*machine)
+	c.JSON(http.StatusOK, m.snapshot(time.Now()).Config.Metadata)
+}
+
+func (s *Server) setMetadata(c *gin.Context) {
+	input := map[string]string{}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		abortWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := c.MustGet("machine").(*machine)
+	if m.data.Config.Metadata == nil {
+		m.data.Config.Metadata = map[string]string{}
+	}
+	m.data.Config.Metadata[c.Param("key")] = input["value"]
+
+	c.Status(http.StatusNoContent)
+}
+
+func (s *Server) deleteMetadata(c *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := c.MustGet("machine").(*machine)
+	if _, ok := m.data.Config.Metadata[c.Param("key")]; !ok {
+		abortWithError(c, http.StatusNotFound, "metadata key not found")
+		return
+	}
+	delete(m.data.Config.Metadata, c.Param("key"))
+
+	c.Status(http.StatusNoContent)
+}
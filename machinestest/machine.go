@@ -0,0 +1,114 @@
+package machinestest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	machines "github.com/sosedoff/fly-machines"
+)
+
+// step is the machine state reached at the given time
+type step struct {
+	state machines.State
+	at    time.Time
+}
+
+// machine is the fake machine. Its state is computed from the scheduled steps,
+// so transitions happen over time without background goroutines.
+type machine struct {
+	data     machines.Machine
+	seq      int
+	steps    []step
+	lease    *machines.Lease
+	cordoned bool
+}
+
+func (m *machine) state(now time.Time) machines.State {
+	state := machines.StateCreated
+	for _, s := range m.steps {
+		if s.at.After(now) {
+			break
+		}
+		state = s.state
+	}
+	return state
+}
+
+// transition cancels pending steps and schedules the states one after another,
+// each following state is reached after the delay
+func (m *machine) transition(now time.Time, delay time.Duration, states ...machines.State) {
+	steps := []step{}
+	for _, s := range m.steps {
+		if !s.at.After(now) {
+			steps = append(steps, s)
+		}
+	}
+	for i, state := range states {
+		steps = append(steps, step{state: state, at: now.Add(time.Duration(i) * delay)})
+	}
+	m.steps = steps
+	m.data.UpdatedAt = now.UTC().Format(time.RFC3339)
+}
+
+func (m *machine) addEvent(now time.Time, eventType machines.EventType, status machines.EventStatus, request *machines.EventRequest) {
+	event := machines.Event{
+		ID:        randomID(13),
+		Type:      eventType,
+		Status:    status,
+		Request:   request,
+		Source:    "user",
+		Timestamp: now.UnixMilli(),
+	}
+	// Events are listed newest first
+	m.data.Events = append(machines.Events{event}, m.data.Events...)
+}
+
+// activeLease returns the lease if it has not expired yet
+func (m *machine) activeLease(now time.Time) *machines.Lease {
+	if m.lease == nil || now.Unix() >= m.lease.ExpiresAt {
+		return nil
+	}
+	return m.lease
+}
+
+func (m *machine) snapshot(now time.Time) machines.Machine {
+	data := m.data
+	data.State = m.state(now)
+	data.Events = append(machines.Events{}, m.data.Events...)
+
+	data.Config.Metadata = map[string]string{}
+	for k, v := range m.data.Config.Metadata {
+		data.Config.Metadata[k] = v
+	}
+	return data
+}
+
+func (m *machine) matches(now time.Time, region string, includeDeleted bool, metadata map[string]string) bool {
+	if state := m.state(now); !includeDeleted && (state == machines.StateDestroying || state == machines.StateDestroyed) {
+		return false
+	}
+	if region != "" && m.data.Region != region {
+		return false
+	}
+	for k, v := range metadata {
+		if m.data.Config.Metadata[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// randomID returns a random hex string of the given length in bytes
+func randomID(size int) string {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
+
+func newInstanceID() string {
+	return strings.ToUpper(randomID(13))
+}
@@ -0,0 +1,383 @@
+// Package machinestest provides a stateful in-memory fake of the Machines API
+// for testing code built on top of the client.
+//
+// The fake models machines created by the client, their state transitions over
+// time, leases, wait requests and injected failures. Create it with New and use
+// Server.Client to call it in-process, or call Start first to serve it over HTTP.
+package machinestest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	machines "github.com/sosedoff/fly-machines"
+)
+
+// DefaultLeaseTTL is used when the lease request does not set the TTL
+const DefaultLeaseTTL = 30 * time.Second
+
+// DefaultRegion is used for machines created without a region
+const DefaultRegion = "ord"
+
+var errServerClosed = errors.New("machinestest: server closed")
+
+// Option configures the fake server
+type Option func(*Server)
+
+// WithApps limits the served apps, requests to other apps fail with 404.
+// All apps are served by default.
+func WithApps(names ...string) Option {
+	return func(s *Server) {
+		if s.apps == nil {
+			s.apps = map[string]bool{}
+		}
+		for _, name := range names {
+			s.apps[name] = true
+		}
+	}
+}
+
+// WithTransitionDelay sets how long machines stay in each intermediate state,
+// e.g. "starting" before becoming "started". Transitions are instant by default.
+func WithTransitionDelay(delay time.Duration) Option {
+	return func(s *Server) {
+		s.transitionDelay = delay
+	}
+}
+
+// Fault describes the failure injected into matching requests
+type Fault struct {
+	Method  string        // Request method, any method if empty
+	Path    string        // Request path pattern without the /v1 prefix, e.g. "/apps/*/machines/*/start", any path if empty
+	Status  int           // Response status, the request is served normally if zero
+	Message string        // Error message, status text by default
+	Delay   time.Duration // Latency added before the response
+	Count   int           // Number of requests to fail, zero to fail all matching requests
+}
+
+func (f *Fault) matches(req *http.Request) bool {
+	if f.Method != "" && f.Method != req.Method {
+		return false
+	}
+	if f.Path == "" {
+		return true
+	}
+	ok, _ := path.Match(f.Path, strings.TrimPrefix(req.URL.Path, "/v1"))
+	return ok
+}
+
+// Server is the fake Machines API server
+type Server struct {
+	// URL of the server when started with Start, empty otherwise
+	URL string
+
+	apps            map[string]bool
+	transitionDelay time.Duration
+	machines        map[string]map[string]*machine
+	faults          []*Fault
+	seq             int
+	handler         http.Handler
+	server          *httptest.Server
+	closed          bool
+	mu              sync.Mutex
+}
+
+// New returns the fake server that is not listening on any port. Use it as
+// http.Handler, via Transport or with the client returned by Client, and call
+// Start to serve it on a local port.
+func New(opts ...Option) *Server {
+	s := &Server{
+		machines: map[string]map[string]*machine{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.handler = s.routes()
+
+	return s
+}
+
+// Start serves the fake server on a local port. Clients returned by Client
+// send requests over HTTP once the server is started.
+func (s *Server) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.server != nil {
+		panic("machinestest: server already started")
+	}
+	s.server = httptest.NewServer(s.handler)
+	s.URL = s.server.URL
+}
+
+// Close shuts down the server. Requests sent in-process or over HTTP fail
+// once the server is closed.
+func (s *Server) Close() {
+	s.mu.Lock()
+	server := s.server
+	s.closed = true
+	s.mu.Unlock()
+
+	if server != nil {
+		server.Close()
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.handler.ServeHTTP(w, req)
+}
+
+// Transport returns the round tripper that serves requests in-process
+func (s *Server) Transport() http.RoundTripper {
+	return machines.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		s.mu.Lock()
+		closed := s.closed
+		s.mu.Unlock()
+		if closed {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, errServerClosed
+		}
+
+		rec := httptest.NewRecorder()
+		s.handler.ServeHTTP(rec, req)
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		if err := req.Context().Err(); err != nil {
+			return nil, err
+		}
+
+		resp := rec.Result()
+		resp.Request = req
+		return resp, nil
+	})
+}
+
+// Client returns the client for the app that talks to the server. Requests are
+// sent over HTTP if the server was started with Start, in-process otherwise.
+func (s *Server) Client(appName string, opts ...machines.Option) *machines.Client {
+	s.mu.Lock()
+	started := s.server != nil
+	s.mu.Unlock()
+
+	base := []machines.Option{machines.WithToken("test-token")}
+	if started {
+		base = append(base, machines.WithBaseURL(s.URL))
+	} else {
+		base = append(base, machines.WithBaseURL("http://machinestest.internal"), machines.WithTransport(s.Transport()))
+	}
+
+	return machines.NewClient(appName, append(base, opts...)...)
+}
+
+// InjectFault makes matching requests fail or slow down. Faults are checked in
+// the order they are added and removed once their count is used up.
+func (s *Server) InjectFault(fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = append(s.faults, &fault)
+}
+
+// ClearFaults removes all injected faults
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = nil
+}
+
+// Machine returns the current state of the app machine
+func (s *Server) Machine(appName, id string) (*machines.Machine, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.machines[appName][id]
+	if !ok {
+		return nil, false
+	}
+	data := m.snapshot(time.Now())
+	return &data, true
+}
+
+// fault returns the first fault matching the request and uses up its count
+func (s *Server) fault(req *http.Request) *Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, f := range s.faults {
+		if !f.matches(req) {
+			continue
+		}
+		result := *f
+		if f.Count > 0 {
+			f.Count--
+			if f.Count == 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+		}
+		return &result
+	}
+	return nil
+}
+
+func (s *Server) injectFaults(c *gin.Context) {
+	f := s.fault(c.Request)
+	if f == nil {
+		return
+	}
+
+	if f.Delay > 0 {
+		timer := time.NewTimer(f.Delay)
+		defer timer.Stop()
+
+		select {
+		case <-c.Request.Context().Done():
+			c.Abort()
+			return
+		case <-timer.C:
+		}
+	}
+
+	if f.Status > 0 {
+		message := f.Message
+		if message == "" {
+			message = strings.ToLower(http.StatusText(f.Status))
+		}
+		abortWithError(c, f.Status, message)
+	}
+}
+
+func (s *Server) requireAuth(c *gin.Context) {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		abortWithError(c, http.StatusUnauthorized, "unauthorized")
+	}
+}
+
+func (s *Server) requireApp(c *gin.Context) {
+	if s.apps != nil && !s.apps[c.Param("app")] {
+		abortWithError(c, http.StatusNotFound, "app not found")
+	}
+}
+
+func (s *Server) requireMachine(c *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.machines[c.Param("app")][c.Param("id")]
+	if !ok {
+		abortWithError(c, http.StatusNotFound, "machine not found")
+		return
+	}
+	c.Set("machine", m)
+}
+
+// requireLease rejects mutating requests to destroyed machines and to machines
+// leased with another nonce
+func (s *Server) requireLease(c *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := c.MustGet("machine").(*machine)
+	now := time.Now()
+
+	if state := m.state(now); state == machines.StateDestroying || state == machines.StateDestroyed {
+		abortWithError(c, http.StatusPreconditionFailed, "machine has been destroyed")
+		return
+	}
+	if lease := m.activeLease(now); lease != nil && lease.Nonce != c.GetHeader("fly-machine-lease-nonce") {
+		abortWithError(c, http.StatusConflict, "lease currently held by "+lease.Owner)
+	}
+}
+
+func (s *Server) routes() http.Handler {
+	srv := gin.New()
+	srv.Use(func(c *gin.Context) {
+		c.Header("Content-Type", "application/json")
+		c.Header("Fly-Request-Id", randomID(8))
+	})
+	srv.Use(s.injectFaults, s.requireAuth)
+	srv.NoRoute(func(c *gin.Context) {
+		abortWithError(c, http.StatusNotFound, "not found")
+	})
+
+	api := srv.Group("/v1/apps/:app", s.requireApp)
+	{
+		api.GET("/machines", s.listMachines)
+		api.POST("/machines", s.createMachine)
+
+		m := api.Group("/machines/:id", s.requireMachine)
+		m.GET("", s.getMachine)
+		m.GET("/wait", s.waitMachine)
+		m.GET("/events", s.listEvents)
+		m.GET("/metadata", s.getMetadata)
+		m.POST("/lease", s.acquireLease)
+		m.DELETE("/lease", s.releaseLease)
+
+		leased := m.Group("", s.requireLease)
+		leased.POST("", s.updateMachine)
+		leased.DELETE("", s.deleteMachine)
+		leased.POST("/start", s.startMachine)
+		leased.POST("/stop", s.stopMachine)
+		leased.POST("/restart", s.restartMachine)
+		leased.POST("/suspend", s.suspendMachine)
+		leased.POST("/signal", s.signalMachine)
+		leased.POST("/cordon", s.cordonMachine)
+		leased.POST("/uncordon", s.uncordonMachine)
+		leased.POST("/metadata/:key", s.setMetadata)
+		leased.DELETE("/metadata/:key", s.deleteMetadata)
+	}
+
+	return srv.Handler()
+}
+
+func abortWithError(c *gin.Context, status int, message string) {
+	c.AbortWithStatusJSON(status, gin.H{"error": message})
+}
+
+func abortWithStateError(c *gin.Context, action string, state machines.State) {
+	abortWithError(c, http.StatusPreconditionFailed, fmt.Sprintf("unable to %s machine from current state: '%s'", action, state))
+}
+
+// machineStateIn returns the machine state, and whether it is one of the given states
+func machineStateIn(m *machine, now time.Time, states ...machines.State) (machines.State, bool) {
+	current := m.state(now)
+	for _, state := range states {
+		if current == state {
+			return current, true
+		}
+	}
+	return current, false
+}
+
+// waitContext returns the context for the wait request with the requested timeout
+func waitContext(ctx context.Context, timeout string) (context.Context, context.CancelFunc, error) {
+	duration := 60 * time.Second
+	if timeout != "" {
+		// Timeout is accepted both as a duration string and in seconds
+		if _, err := strconv.Atoi(timeout); err == nil {
+			timeout += "s"
+		}
+		val, err := time.ParseDuration(timeout)
+		if err != nil {
+			return nil, nil, err
+		}
+		duration = val
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	return ctx, cancel, nil
+}
@@ -0,0 +1,207 @@
+package machinestest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	machines "github.com/sosedoff/fly-machines"
+	"github.com/sosedoff/fly-machines/machinestest"
+)
+
+func TestMachineLifecycle(t *testing.T) {
+	srv := machinestest.New(machinestest.WithTransitionDelay(50 * time.Millisecond))
+	srv.Start()
+	defer srv.Close()
+
+	client := srv.Client("app")
+	ctx := context.Background()
+
+	machine, err := client.CreateContext(ctx, &machines.CreateInput{
+		Name:   "web-1",
+		Region: "iad",
+		Config: &machines.Config{Image: "nginx", Metadata: map[string]string{"role": "web"}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, machines.StateCreated, machine.State)
+	require.Equal(t, "iad", machine.Region)
+
+	// Wait times out if the state is not reached in time
+	err = client.WaitContext(ctx, &machines.WaitInput{ID: machine.ID, State: machines.StateStarted, Timeout: 10 * time.Millisecond})
+	require.Error(t, err)
+	require.Equal(t, http.StatusRequestTimeout, err.(machines.APIError).StatusCode)
+
+	require.NoError(t, client.WaitStarted(ctx, machine))
+	current, err := client.GetContext(ctx, &machines.GetInput{ID: machine.ID})
+	require.NoError(t, err)
+	require.Equal(t, machines.StateStarted, current.State)
+
+	_, err = client.StartContext(ctx, &machines.StartInput{ID: machine.ID})
+	require.ErrorIs(t, err, machines.ErrPreconditionFailed)
+	require.Equal(t, "unable to start machine from current state: 'started'", err.Error())
+
+	require.NoError(t, client.StopContext(ctx, &machines.StopInput{ID: machine.ID}))
+	current, err = client.GetContext(ctx, &machines.GetInput{ID: machine.ID})
+	require.NoError(t, err)
+	require.Equal(t, machines.StateStopping, current.State)
+	require.NoError(t, client.WaitStopped(ctx, machine))
+
+	result, err := client.StartContext(ctx, &machines.StartInput{ID: machine.ID})
+	require.NoError(t, err)
+	require.Equal(t, machines.StateStopped, result.PreviousState)
+	require.NoError(t, client.WaitContext(ctx, result.WaitInput()))
+
+	events, err := client.ListEventsContext(ctx, &machines.GetInput{ID: machine.ID})
+	require.NoError(t, err)
+	require.Equal(t, machines.EventTypeStart, events[0].Type)
+	require.Equal(t, machines.EventTypeLaunch, events[len(events)-1].Type)
+
+	err = client.DeleteContext(ctx, &machines.DeleteInput{ID: machine.ID})
+	require.ErrorIs(t, err, machines.ErrPreconditionFailed)
+	require.NoError(t, client.DeleteContext(ctx, &machines.DeleteInput{ID: machine.ID, Kill: true}))
+	require.NoError(t, client.WaitDestroyed(ctx, machine))
+
+	list, err := client.ListContext(ctx, nil)
+	require.NoError(t, err)
+	require.Empty(t, list)
+
+	list, err = client.ListContext(ctx, &machines.ListInput{IncludeDeleted: true, Metadata: map[string]string{"role": "web"}})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(list))
+	require.Equal(t, machines.StateDestroyed, list[0].State)
+
+	_, err = client.GetContext(ctx, &machines.GetInput{ID: "missing"})
+	require.True(t, machines.IsNotFound(err))
+}
+
+func TestUpdateAndMetadata(t *testing.T) {
+	srv := machinestest.New()
+	defer srv.Close()
+	client := srv.Client("app")
+	ctx := context.Background()
+
+	machine, err := client.CreateContext(ctx, &machines.CreateInput{Config: &machines.Config{Image: "nginx:1"}})
+	require.NoError(t, err)
+	require.Equal(t, machines.StateStarted, machine.State)
+
+	updated, err := client.UpdateContext(ctx, &machines.UpdateInput{
+		ID:             machine.ID,
+		Config:         &machines.Config{Image: "nginx:2"},
+		CurrentVersion: machine.InstanceID,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "nginx:2", updated.Config.Image)
+	require.NotEqual(t, machine.InstanceID, updated.InstanceID)
+
+	_, err = client.UpdateContext(ctx, &machines.UpdateInput{
+		ID:             machine.ID,
+		Config:         &machines.Config{Image: "nginx:3"},
+		CurrentVersion: machine.InstanceID,
+	})
+	var conflict machines.VersionConflictError
+	require.ErrorAs(t, err, &conflict)
+
+	require.NoError(t, client.SetMetadataKeyContext(ctx, &machines.MetadataInput{ID: machine.ID, Key: "tenant", Value: "acme"}))
+	metadata, err := client.GetMetadataContext(ctx, &machines.GetInput{ID: machine.ID})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"tenant": "acme"}, metadata)
+
+	state, ok := srv.Machine("app", machine.ID)
+	require.True(t, ok)
+	require.Equal(t, "acme", state.Config.Metadata["tenant"])
+}
+
+func TestLeases(t *testing.T) {
+	srv := machinestest.New()
+	defer srv.Close()
+	client := srv.Client("app")
+	ctx := context.Background()
+
+	machine, err := client.CreateContext(ctx, &machines.CreateInput{Config: &machines.Config{}})
+	require.NoError(t, err)
+
+	lease, err := client.LeaseContext(ctx, &machines.LeaseInput{ID: machine.ID, TTL: 60})
+	require.NoError(t, err)
+	require.NotEmpty(t, lease.Nonce)
+
+	_, err = client.LeaseContext(ctx, &machines.LeaseInput{ID: machine.ID})
+	require.ErrorIs(t, err, machines.ErrLeaseHeld)
+
+	err = client.StopContext(ctx, &machines.StopInput{ID: machine.ID})
+	require.ErrorIs(t, err, machines.ErrLeaseHeld)
+
+	leased := client.WithLease(lease)
+	require.NoError(t, leased.StopContext(ctx, &machines.StopInput{ID: machine.ID}))
+
+	renewed, err := client.LeaseContext(ctx, &machines.LeaseInput{ID: machine.ID, Nonce: lease.Nonce})
+	require.NoError(t, err)
+	require.Equal(t, lease.Nonce, renewed.Nonce)
+
+	require.NoError(t, client.ReleaseLeaseContext(ctx, &machines.LeaseInput{ID: machine.ID, Nonce: lease.Nonce}))
+	_, err = client.StartContext(ctx, &machines.StartInput{ID: machine.ID})
+	require.NoError(t, err)
+}
+
+func TestFaults(t *testing.T) {
+	srv := machinestest.New(machinestest.WithApps("app"))
+	defer srv.Close()
+	client := srv.Client("app", machines.WithRetryPolicy(&machines.RetryPolicy{MaxAttempts: 3}))
+	ctx := context.Background()
+
+	_, err := srv.Client("other").ListContext(ctx, nil)
+	require.True(t, machines.IsNotFound(err))
+
+	srv.InjectFault(machinestest.Fault{
+		Method: http.MethodPost,
+		Path:   "/apps/*/machines",
+		Status: http.StatusServiceUnavailable,
+		Count:  1,
+	})
+	_, err = client.CreateContext(ctx, &machines.CreateInput{Config: &machines.Config{}})
+	require.ErrorIs(t, err, machines.ErrServerError)
+	require.Equal(t, "service unavailable", err.Error())
+
+	// Only the first request failed, the retried list request succeeds
+	srv.InjectFault(machinestest.Fault{Path: "/apps/*/machines", Status: http.StatusBadGateway, Count: 1})
+	list, err := client.ListContext(ctx, nil)
+	require.NoError(t, err)
+	require.Empty(t, list)
+
+	srv.InjectFault(machinestest.Fault{Delay: time.Second})
+	timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = client.ListContext(timeoutCtx, nil)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	srv.ClearFaults()
+	_, err = client.CreateContext(ctx, &machines.CreateInput{Config: &machines.Config{}})
+	require.NoError(t, err)
+}
+
+func TestClose(t *testing.T) {
+	ctx := context.Background()
+
+	srv := machinestest.New()
+	client := srv.Client("app")
+	_, err := client.ListContext(ctx, nil)
+	require.NoError(t, err)
+
+	srv.Close()
+	_, err = client.ListContext(ctx, nil)
+	require.ErrorContains(t, err, "server closed")
+
+	srv = machinestest.New()
+	srv.Start()
+	client = srv.Client("app")
+	require.NotEmpty(t, srv.URL)
+	_, err = client.ListContext(ctx, nil)
+	require.NoError(t, err)
+
+	srv.Close()
+	_, err = client.ListContext(ctx, nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,142 @@
+package machines
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// EncodeMetadata converts the struct into machine metadata map.
+//
+// Fields are named using the `metadata:"name"` tag, or the field name if no tag
+// is set. Fields tagged with "-" are skipped, and zero values are skipped when
+// the tag has the "omitempty" option. Supported types are strings, bools,
+// integers and floats.
+func EncodeMetadata(v any) (map[string]string, error) {
+	val := reflect.Indirect(reflect.ValueOf(v))
+	if val.Kind() != reflect.Struct {
+		return nil, ErrInvalidMetadataTarget
+	}
+
+	result := map[string]string{}
+
+	for i := 0; i < val.NumField(); i++ {
+		field := val.Type().Field(i)
+		name, omitEmpty, ok := metadataFieldName(field)
+		if !ok {
+			continue
+		}
+
+		fieldVal := val.Field(i)
+		if omitEmpty && fieldVal.IsZero() {
+			continue
+		}
+
+		str, err := formatMetadataValue(fieldVal)
+		if err != nil {
+			return nil, fmt.Errorf("metadata field %s: %w", field.Name, err)
+		}
+		result[name] = str
+	}
+
+	return result, nil
+}
+
+// DecodeMetadata populates the struct pointed by v from machine metadata map.
+// Keys missing in the map leave the corresponding fields unchanged.
+func DecodeMetadata(metadata map[string]string, v any) error {
+	ptr := reflect.ValueOf(v)
+	if ptr.Kind() != reflect.Pointer || ptr.IsNil() || ptr.Elem().Kind() != reflect.Struct {
+		return ErrInvalidMetadataTarget
+	}
+	val := ptr.Elem()
+
+	for i := 0; i < val.NumField(); i++ {
+		field := val.Type().Field(i)
+		name, _, ok := metadataFieldName(field)
+		if !ok {
+			continue
+		}
+
+		str, exists := metadata[name]
+		if !exists {
+			continue
+		}
+
+		if err := parseMetadataValue(val.Field(i), str); err != nil {
+			return fmt.Errorf("metadata field %s: %w", field.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func metadataFieldName(field reflect.StructField) (name string, omitEmpty bool, ok bool) {
+	if !field.IsExported() {
+		return "", false, false
+	}
+
+	tag := field.Tag.Get("metadata")
+	if tag == "-" {
+		return "", false, false
+	}
+
+	name, opts, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = field.Name
+	}
+
+	return name, opts == "omitempty", true
+}
+
+func formatMetadataValue(val reflect.Value) (string, error) {
+	switch val.Kind() {
+	case reflect.String:
+		return val.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(val.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(val.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(val.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(val.Float(), 'f', -1, val.Type().Bits()), nil
+	default:
+		return "", fmt.Errorf("unsupported type %s", val.Type())
+	}
+}
+
+func parseMetadataValue(val reflect.Value, str string) error {
+	switch val.Kind() {
+	case reflect.String:
+		val.SetString(str)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(str)
+		if err != nil {
+			return err
+		}
+		val.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(str, 10, val.Type().Bits())
+		if err != nil {
+			return err
+		}
+		val.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(str, 10, val.Type().Bits())
+		if err != nil {
+			return err
+		}
+		val.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(str, val.Type().Bits())
+		if err != nil {
+			return err
+		}
+		val.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", val.Type())
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package machines_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	machines "github.com/sosedoff/fly-machines"
+)
+
+type testMetadata struct {
+	Tenant  string  `metadata:"tenant"`
+	Release int     `metadata:"release,omitempty"`
+	Primary bool    `metadata:"primary"`
+	Weight  float64 `metadata:"weight,omitempty"`
+	Region  string
+	Ignored string `metadata:"-"`
+	private string //nolint:unused
+}
+
+func TestEncodeMetadata(t *testing.T) {
+	_, err := machines.EncodeMetadata("foo")
+	require.Equal(t, machines.ErrInvalidMetadataTarget, err)
+
+	result, err := machines.EncodeMetadata(testMetadata{Tenant: "acme", Ignored: "foo"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"tenant": "acme", "primary": "false", "Region": ""}, result)
+
+	result, err = machines.EncodeMetadata(&testMetadata{Tenant: "acme", Release: 12, Primary: true, Weight: 0.5, Region: "ord"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"tenant":  "acme",
+		"release": "12",
+		"primary": "true",
+		"weight":  "0.5",
+		"Region":  "ord",
+	}, result)
+
+	result, err = machines.EncodeMetadata(struct {
+		Ratio float32 `metadata:"ratio"`
+	}{Ratio: 0.1})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"ratio": "0.1"}, result)
+
+	_, err = machines.EncodeMetadata(struct{ Tags []string }{})
+	require.EqualError(t, err, "metadata field Tags: unsupported type []string")
+}
+
+func TestDecodeMetadata(t *testing.T) {
+	require.Equal(t, machines.ErrInvalidMetadataTarget, machines.DecodeMetadata(nil, testMetadata{}))
+	require.Equal(t, machines.ErrInvalidMetadataTarget, machines.DecodeMetadata(nil, (*testMetadata)(nil)))
+
+	result := testMetadata{Region: "iad"}
+	err := machines.DecodeMetadata(map[string]string{
+		"tenant":  "acme",
+		"release": "12",
+		"primary": "true",
+		"weight":  "0.5",
+		"Ignored": "foo",
+	}, &result)
+	require.NoError(t, err)
+	require.Equal(t, testMetadata{Tenant: "acme", Release: 12, Primary: true, Weight: 0.5, Region: "iad"}, result)
+
+	err = machines.DecodeMetadata(map[string]string{"release": "latest"}, &result)
+	require.EqualError(t, err, `metadata field Release: strconv.ParseInt: parsing "latest": invalid syntax`)
+}
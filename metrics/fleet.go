@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	machines "github.com/sosedoff/fly-machines"
+)
+
+// stateUnknown is reported for machines in states missing from machines.States
+const stateUnknown = machines.State("unknown")
+
+// fleetStates lists the reported states, machines.States followed by stateUnknown
+var fleetStates = append(slices.Clone(machines.States), stateUnknown)
+
+// FleetCollector reports the number of app machines per state and region.
+// Machines are listed by Refresh or periodically by Run, scrapes report the
+// result of the last successful refresh. Machines in states missing from
+// machines.States are reported with the "unknown" state.
+type FleetCollector struct {
+	client        *machines.Client
+	machines      *prometheus.Desc
+	refreshErrors prometheus.Counter
+	counts        map[string]map[machines.State]int // Machine count by region and state
+	mu            sync.Mutex
+}
+
+func NewFleetCollector(client *machines.Client) *FleetCollector {
+	return &FleetCollector{
+		client: client,
+		machines: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "fleet", "machines"),
+			"Number of app machines by state and region.",
+			[]string{"region", "state"},
+			prometheus.Labels{"app": client.GetAppName()},
+		),
+		refreshErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   "fleet",
+			Name:        "refresh_errors_total",
+			Help:        "Number of failed attempts to list app machines.",
+			ConstLabels: prometheus.Labels{"app": client.GetAppName()},
+		}),
+	}
+}
+
+// Refresh lists the app machines and updates the reported counts
+func (c *FleetCollector) Refresh(ctx context.Context) error {
+	list, err := c.client.ListContext(ctx, nil)
+	if err != nil {
+		c.refreshErrors.Inc()
+		return err
+	}
+
+	counts := map[string]map[machines.State]int{}
+	for _, m := range list {
+		if counts[m.Region] == nil {
+			counts[m.Region] = map[machines.State]int{}
+		}
+		state := stateUnknown
+		if slices.Contains(machines.States, m.State) {
+			state = m.State
+		}
+		counts[m.Region][state]++
+	}
+
+	c.mu.Lock()
+	c.counts = counts
+	c.mu.Unlock()
+
+	return nil
+}
+
+// Run refreshes the counts every interval until the context is done. Failed
+// refreshes keep the previous counts and are reported by the errors counter.
+func (c *FleetCollector) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		_ = c.Refresh(ctx)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *FleetCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.machines
+	c.refreshErrors.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (c *FleetCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for region, states := range c.counts {
+		for _, state := range fleetStates {
+			ch <- prometheus.MustNewConstMetric(c.machines, prometheus.GaugeValue, float64(states[state]), region, string(state))
+		}
+	}
+	c.refreshErrors.Collect(ch)
+}
@@ -0,0 +1,81 @@
+// Package metrics exports Prometheus metrics for the machines client and app fleet
+package metrics
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	machines "github.com/sosedoff/fly-machines"
+)
+
+const namespace = "fly_machines"
+
+// ClientMetrics collects request counts, latencies and errors of the client
+// API calls by operation and status. Register it with a Prometheus registry
+// and add its middleware to the client.
+type ClientMetrics struct {
+	requests *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+func NewClientMetrics() *ClientMetrics {
+	labels := []string{"operation", "status"}
+
+	return &ClientMetrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "client",
+			Name:      "requests_total",
+			Help:      "Number of API calls made by the client.",
+		}, labels),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "client",
+			Name:      "errors_total",
+			Help:      "Number of failed API calls made by the client.",
+		}, labels),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "client",
+			Name:      "request_duration_seconds",
+			Help:      "Duration of API calls made by the client, including retries.",
+			Buckets:   prometheus.DefBuckets,
+		}, labels),
+	}
+}
+
+// Middleware returns the client middleware that records the metrics
+func (m *ClientMetrics) Middleware() machines.Middleware {
+	return machines.Middleware{
+		Done: m.observe,
+	}
+}
+
+func (m *ClientMetrics) observe(call *machines.Call, err error) {
+	status := "error"
+	if call.StatusCode != 0 {
+		status = strconv.Itoa(call.StatusCode)
+	}
+
+	m.requests.WithLabelValues(call.Operation, status).Inc()
+	m.duration.WithLabelValues(call.Operation, status).Observe(call.Duration.Seconds())
+	if err != nil {
+		m.errors.WithLabelValues(call.Operation, status).Inc()
+	}
+}
+
+// Describe implements prometheus.Collector
+func (m *ClientMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.requests.Describe(ch)
+	m.errors.Describe(ch)
+	m.duration.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (m *ClientMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.requests.Collect(ch)
+	m.errors.Collect(ch)
+	m.duration.Collect(ch)
+}
@@ -0,0 +1,141 @@
+package metrics_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	machines "github.com/sosedoff/fly-machines"
+	"github.com/sosedoff/fly-machines/metrics"
+	"github.com/sosedoff/fly-machines/testdata"
+)
+
+func TestClientMetrics(t *testing.T) {
+	srv := testdata.Server("app")
+	defer srv.Close()
+
+	clientMetrics := metrics.NewClientMetrics()
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(clientMetrics)
+
+	client := machines.NewClient("app",
+		machines.WithBaseURL(srv.URL),
+		machines.WithToken("api_token"),
+		machines.WithMiddleware(clientMetrics.Middleware()),
+	)
+	ctx := context.Background()
+
+	_, err := client.GetContext(ctx, &machines.GetInput{ID: "1"})
+	require.NoError(t, err)
+	_, err = client.GetContext(ctx, &machines.GetInput{ID: "1"})
+	require.NoError(t, err)
+	_, err = client.GetContext(ctx, &machines.GetInput{ID: "foo"})
+	require.Error(t, err)
+
+	expected := `
+# HELP fly_machines_client_errors_total Number of failed API calls made by the client.
+# TYPE fly_machines_client_errors_total counter
+fly_machines_client_errors_total{operation="GET /apps/{app}/machines/{id}",status="404"} 1
+# HELP fly_machines_client_requests_total Number of API calls made by the client.
+# TYPE fly_machines_client_requests_total counter
+fly_machines_client_requests_total{operation="GET /apps/{app}/machines/{id}",status="200"} 2
+fly_machines_client_requests_total{operation="GET /apps/{app}/machines/{id}",status="404"} 1
+`
+	err = testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"fly_machines_client_requests_total",
+		"fly_machines_client_errors_total",
+	)
+	require.NoError(t, err)
+
+	count, err := testutil.GatherAndCount(registry, "fly_machines_client_request_duration_seconds")
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+}
+
+func TestFleetCollector(t *testing.T) {
+	srv := testdata.Server("app")
+	defer srv.Close()
+
+	client := machines.NewClient("app", machines.WithBaseURL(srv.URL), machines.WithToken("api_token"))
+	collector := metrics.NewFleetCollector(client)
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(collector)
+
+	count, err := testutil.GatherAndCount(registry, "fly_machines_fleet_machines")
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+
+	require.NoError(t, collector.Refresh(context.Background()))
+
+	count, err = testutil.GatherAndCount(registry, "fly_machines_fleet_machines")
+	require.NoError(t, err)
+	require.Equal(t, len(machines.States)+1, count)
+
+	expected := `
+# HELP fly_machines_fleet_machines Number of app machines by state and region.
+# TYPE fly_machines_fleet_machines gauge
+fly_machines_fleet_machines{app="app",region="ord",state="created"} 0
+fly_machines_fleet_machines{app="app",region="ord",state="destroyed"} 0
+fly_machines_fleet_machines{app="app",region="ord",state="destroying"} 0
+fly_machines_fleet_machines{app="app",region="ord",state="replacing"} 0
+fly_machines_fleet_machines{app="app",region="ord",state="started"} 0
+fly_machines_fleet_machines{app="app",region="ord",state="starting"} 0
+fly_machines_fleet_machines{app="app",region="ord",state="stopped"} 1
+fly_machines_fleet_machines{app="app",region="ord",state="stopping"} 0
+fly_machines_fleet_machines{app="app",region="ord",state="suspended"} 0
+fly_machines_fleet_machines{app="app",region="ord",state="suspending"} 0
+fly_machines_fleet_machines{app="app",region="ord",state="unknown"} 0
+`
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "fly_machines_fleet_machines"))
+
+	// Failed refresh keeps the previous counts
+	srv.Close()
+	require.Error(t, collector.Refresh(context.Background()))
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "fly_machines_fleet_machines"))
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP fly_machines_fleet_refresh_errors_total Number of failed attempts to list app machines.
+# TYPE fly_machines_fleet_refresh_errors_total counter
+fly_machines_fleet_refresh_errors_total{app="app"} 1
+`), "fly_machines_fleet_refresh_errors_total"))
+}
+
+func TestFleetCollectorUnknownState(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"id":"1","state":"started","region":"ord"},{"id":"2","state":"migrating","region":"ord"}]`)
+	}))
+	defer srv.Close()
+
+	client := machines.NewClient("app", machines.WithBaseURL(srv.URL), machines.WithToken("api_token"))
+	collector := metrics.NewFleetCollector(client)
+	require.NoError(t, collector.Refresh(context.Background()))
+
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(collector)
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+
+	counts := map[string]float64{}
+	for _, family := range families {
+		if family.GetName() != "fly_machines_fleet_machines" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "state" {
+					counts[label.GetValue()] = metric.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+	require.Equal(t, float64(1), counts["started"])
+	require.Equal(t, float64(1), counts["unknown"])
+}
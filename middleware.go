@@ -0,0 +1,157 @@
+package machines
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Call describes the API call passed to middleware hooks. Operation, AppName and
+// MachineID are derived from Request and updated after every BeforeRequest hook.
+type Call struct {
+	Operation  string        // Route of the call, e.g. "POST /apps/{app}/machines/{id}/stop"
+	AppName    string        // App name, if the call is scoped to an app
+	MachineID  string        // Machine ID, if the call targets a machine
+	Request    *http.Request // Request to send, could be modified or replaced by BeforeRequest.
+	Region     string        // Machine region, if the call returned a machine
+	StatusCode int           // Response status code, zero if no response was received
+	Attempts   int           // Number of attempts made, more than one if the call was retried
+	Duration   time.Duration // Time spent on the call including retries
+}
+
+// Middleware hooks into every API call made by the client. Any hook may be nil.
+type Middleware struct {
+	// BeforeRequest is called before the request is sent. Returning an error
+	// aborts the call.
+	BeforeRequest func(call *Call) error
+
+	// AfterResponse is called when the response is received, before the body is read
+	AfterResponse func(call *Call, resp *http.Response)
+
+	// OnError is called when the call fails, including API error responses
+	OnError func(call *Call, err error)
+
+	// Done is called when the call completes, err is nil if the call succeeded
+	Done func(call *Call, err error)
+
+	// StartOperation is called when a client method, such as CreateContext,
+	// starts. The returned context is used for the API calls made by the method.
+	StartOperation func(ctx context.Context, name string) context.Context
+
+	// EndOperation is called when the client method returns, err is nil if the
+	// method succeeded
+	EndOperation func(ctx context.Context, name string, err error)
+}
+
+// operation is the client method invocation passed to middleware hooks
+type operation struct {
+	hooks []Middleware
+	ctx   context.Context
+	name  string
+}
+
+// startOperation notifies middlewares that the client method starts and
+// replaces ctx with the context returned by them. Use it with defer:
+//
+//	defer c.startOperation(&ctx, "Get").end(&err)
+func (c *Client) startOperation(ctx *context.Context, name string) *operation {
+	for _, mw := range c.hooks {
+		if mw.StartOperation != nil {
+			*ctx = mw.StartOperation(*ctx, name)
+		}
+	}
+	return &operation{hooks: c.hooks, ctx: *ctx, name: name}
+}
+
+func (op *operation) end(err *error) {
+	for i := len(op.hooks) - 1; i >= 0; i-- {
+		if fn := op.hooks[i].EndOperation; fn != nil {
+			fn(op.ctx, op.name, *err)
+		}
+	}
+}
+
+// WithMiddleware adds middleware hooks. BeforeRequest hooks run in the order
+// the middlewares are added, other hooks in reverse order.
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(c *Client) {
+		c.hooks = append(c.hooks, middlewares...)
+	}
+}
+
+// routeParams lists the path segments that are followed by a resource identifier
+var routeParams = map[string]string{
+	"apps":           "{app}",
+	"machines":       "{id}",
+	"volumes":        "{id}",
+	"secrets":        "{name}",
+	"metadata":       "{key}",
+	"ip_assignments": "{ip}",
+	"certificates":   "{hostname}",
+}
+
+func newCall(req *http.Request) *Call {
+	call := &Call{Request: req}
+	call.parseRequest()
+	return call
+}
+
+// parseRequest sets the call fields derived from the request
+func (call *Call) parseRequest() {
+	call.Operation = operationName(call.Request)
+	call.AppName = appNameFromPath(call.Request.URL.Path)
+	call.MachineID = machineIDFromPath(call.Request.URL.Path)
+}
+
+// operationName returns the request route with identifiers replaced by placeholders
+func operationName(req *http.Request) string {
+	segments := strings.Split(strings.TrimPrefix(req.URL.Path, "/v1"), "/")
+	for i := 1; i < len(segments); i++ {
+		param, ok := routeParams[segments[i-1]]
+		if !ok || segments[i] == "acme" {
+			continue
+		}
+		segments[i] = param
+		i++
+	}
+	return req.Method + " " + strings.Join(segments, "/")
+}
+
+func (c *Client) beforeRequest(call *Call) error {
+	for _, mw := range c.hooks {
+		if mw.BeforeRequest == nil {
+			continue
+		}
+		if err := mw.BeforeRequest(call); err != nil {
+			return err
+		}
+		// Request could be replaced by the hook
+		call.parseRequest()
+	}
+	return nil
+}
+
+func (c *Client) afterResponse(call *Call, resp *http.Response) {
+	for i := len(c.hooks) - 1; i >= 0; i-- {
+		if fn := c.hooks[i].AfterResponse; fn != nil {
+			fn(call, resp)
+		}
+	}
+}
+
+func (c *Client) onError(call *Call, err error) {
+	for i := len(c.hooks) - 1; i >= 0; i-- {
+		if fn := c.hooks[i].OnError; fn != nil {
+			fn(call, err)
+		}
+	}
+}
+
+func (c *Client) done(call *Call, err error) {
+	for i := len(c.hooks) - 1; i >= 0; i-- {
+		if fn := c.hooks[i].Done; fn != nil {
+			fn(call, err)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package machines_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	machines "github.com/sosedoff/fly-machines"
+	"github.com/sosedoff/fly-machines/testdata"
+)
+
+func TestMiddleware(t *testing.T) {
+	srv := testdata.Server("app", "other")
+	defer srv.Close()
+
+	var (
+		events []string
+		calls  []machines.Call
+		errs   []error
+	)
+	client := machines.NewClient("app",
+		machines.WithBaseURL(srv.URL),
+		machines.WithToken("api_token"),
+		machines.WithMiddleware(
+			machines.Middleware{
+				BeforeRequest: func(call *machines.Call) error {
+					events = append(events, "before:outer")
+					call.Request.Header.Set("X-Trace-ID", "trace")
+					return nil
+				},
+				AfterResponse: func(call *machines.Call, resp *http.Response) {
+					events = append(events, "after:outer")
+					calls = append(calls, *call)
+				},
+				OnError: func(call *machines.Call, err error) {
+					errs = append(errs, err)
+				},
+			},
+			machines.Middleware{
+				BeforeRequest: func(call *machines.Call) error {
+					events = append(events, "before:inner")
+					require.Equal(t, "trace", call.Request.Header.Get("X-Trace-ID"))
+					return nil
+				},
+				AfterResponse: func(call *machines.Call, resp *http.Response) {
+					events = append(events, "after:inner")
+				},
+			},
+		),
+	)
+	ctx := context.Background()
+
+	_, err := client.GetContext(ctx, &machines.GetInput{ID: "1"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"before:outer", "before:inner", "after:inner", "after:outer"}, events)
+	require.Equal(t, "GET /apps/{app}/machines/{id}", calls[0].Operation)
+	require.Equal(t, "app", calls[0].AppName)
+	require.Equal(t, "1", calls[0].MachineID)
+	require.Equal(t, http.StatusOK, calls[0].StatusCode)
+	require.Positive(t, calls[0].Duration)
+	require.Empty(t, errs)
+
+	_, err = client.GetContext(ctx, &machines.GetInput{ID: "foo"})
+	require.Error(t, err)
+	require.Equal(t, http.StatusNotFound, calls[1].StatusCode)
+	require.Equal(t, []error{err}, errs)
+
+	require.NoError(t, client.StopContext(ctx, &machines.StopInput{ID: "1"}))
+	require.Equal(t, "POST /apps/{app}/machines/{id}/stop", calls[2].Operation)
+}
+
+func TestMiddlewareAbort(t *testing.T) {
+	srv := testdata.Server("app", "other")
+	defer srv.Close()
+
+	errBlocked := errors.New("blocked")
+	var failed *machines.Call
+	client := machines.NewClient("app",
+		machines.WithBaseURL(srv.URL),
+		machines.WithToken("api_token"),
+		machines.WithMiddleware(machines.Middleware{
+			BeforeRequest: func(call *machines.Call) error {
+				return errBlocked
+			},
+			OnError: func(call *machines.Call, err error) {
+				failed = call
+			},
+		}),
+	)
+
+	err := client.DeleteContext(context.Background(), &machines.DeleteInput{ID: "1"})
+	require.Equal(t, errBlocked, err)
+	require.Equal(t, "DELETE /apps/{app}/machines/{id}", failed.Operation)
+	require.Zero(t, failed.StatusCode)
+}
+
+func TestMiddlewareReplaceRequest(t *testing.T) {
+	srv := testdata.Server("app", "other")
+	defer srv.Close()
+
+	var calls []machines.Call
+	client := machines.NewClient("app",
+		machines.WithBaseURL(srv.URL),
+		machines.WithToken("api_token"),
+		machines.WithMiddleware(
+			machines.Middleware{
+				BeforeRequest: func(call *machines.Call) error {
+					req := call.Request.Clone(call.Request.Context())
+					req.URL.Path = "/v1/apps/other/machines/2"
+					call.Request = req
+					return nil
+				},
+			},
+			machines.Middleware{
+				BeforeRequest: func(call *machines.Call) error {
+					calls = append(calls, *call)
+					return nil
+				},
+				Done: func(call *machines.Call, err error) {
+					calls = append(calls, *call)
+				},
+			},
+		),
+	)
+
+	_, err := client.GetContext(context.Background(), &machines.GetInput{ID: "1"})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(calls))
+	for _, call := range calls {
+		require.Equal(t, "other", call.AppName)
+		require.Equal(t, "2", call.MachineID)
+		require.Equal(t, "GET /apps/{app}/machines/{id}", call.Operation)
+	}
+}
+
+func TestMiddlewareOperation(t *testing.T) {
+	srv := testdata.Server("app", "other")
+	defer srv.Close()
+
+	type opKey struct{}
+	var events []string
+	client := machines.NewClient("app",
+		machines.WithBaseURL(srv.URL),
+		machines.WithToken("api_token"),
+		machines.WithMiddleware(machines.Middleware{
+			StartOperation: func(ctx context.Context, name string) context.Context {
+				events = append(events, "start:"+name)
+				return context.WithValue(ctx, opKey{}, name)
+			},
+			BeforeRequest: func(call *machines.Call) error {
+				events = append(events, "call:"+call.Request.Context().Value(opKey{}).(string))
+				return nil
+			},
+			EndOperation: func(ctx context.Context, name string, err error) {
+				events = append(events, "end:"+name)
+				if err != nil {
+					events = append(events, "error")
+				}
+			},
+		}),
+	)
+	ctx := context.Background()
+
+	_, err := client.CreateAppContext(ctx, &machines.CreateAppInput{Name: "customer-1", OrgSlug: "customers"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"start:CreateApp", "call:CreateApp", "start:GetApp", "call:GetApp", "end:GetApp", "end:CreateApp"}, events)
+
+	events = nil
+	_, err = client.GetContext(ctx, &machines.GetInput{ID: "foo"})
+	require.Error(t, err)
+	require.Equal(t, []string{"start:Get", "call:Get", "end:Get", "error"}, events)
+}
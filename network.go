@@ -0,0 +1,34 @@
+package machines
+
+type IPAddressType string
+
+const (
+	IPAddressTypeV4        IPAddressType = "v4"         // Dedicated public IPv4
+	IPAddressTypeSharedV4  IPAddressType = "shared_v4"  // Shared public IPv4
+	IPAddressTypeV6        IPAddressType = "v6"         // Dedicated public IPv6
+	IPAddressTypePrivateV6 IPAddressType = "private_v6" // Private IPv6 for Flycast
+)
+
+type IPAddress struct {
+	IP          string        `json:"ip"`
+	Type        IPAddressType `json:"type"`
+	Region      string        `json:"region"`
+	Shared      bool          `json:"shared"`
+	Network     string        `json:"network,omitempty"`
+	ServiceName string        `json:"service_name,omitempty"`
+	CreatedAt   string        `json:"created_at"`
+}
+
+// Public returns true if the address is reachable from the internet
+func (ip IPAddress) Public() bool {
+	return ip.Type != IPAddressTypePrivateV6
+}
+
+type Certificate struct {
+	Hostname              string `json:"hostname"`
+	Configured            bool   `json:"configured"`
+	Status                string `json:"status"`
+	DNSValidationHostname string `json:"dns_validation_hostname"`
+	DNSValidationTarget   string `json:"dns_validation_target"`
+	CreatedAt             string `json:"created_at"`
+}
@@ -0,0 +1,108 @@
+package machines_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	machines "github.com/sosedoff/fly-machines"
+	"github.com/sosedoff/fly-machines/testdata"
+)
+
+func TestIPAddresses(t *testing.T) {
+	srv := testdata.Server("app")
+	defer srv.Close()
+
+	client := testClient(srv.URL)
+	ctx := context.Background()
+
+	_, err := client.AllocateIPAddressContext(ctx, nil)
+	require.Equal(t, machines.ErrInputRequired, err)
+
+	_, err = client.AllocateIPAddressContext(ctx, &machines.AllocateIPAddressInput{Type: "v5"})
+	require.Equal(t, machines.ErrInvalidIPAddressType, err)
+
+	err = client.ReleaseIPAddressContext(ctx, &machines.ReleaseIPAddressInput{})
+	require.Equal(t, machines.ErrIPAddressRequired, err)
+
+	shared, err := client.AllocateIPAddressContext(ctx, &machines.AllocateIPAddressInput{Type: machines.IPAddressTypeSharedV4})
+	require.NoError(t, err)
+	require.True(t, shared.Shared)
+	require.True(t, shared.Public())
+
+	v6, err := client.AllocateIPAddressContext(ctx, &machines.AllocateIPAddressInput{Type: machines.IPAddressTypeV6})
+	require.NoError(t, err)
+	require.Equal(t, "2a09:8280:1::2", v6.IP)
+
+	flycast, err := client.AllocateIPAddressContext(ctx, &machines.AllocateIPAddressInput{
+		Type:    machines.IPAddressTypePrivateV6,
+		Network: "tenant-1",
+	})
+	require.NoError(t, err)
+	require.False(t, flycast.Public())
+	require.Equal(t, "tenant-1", flycast.Network)
+
+	ips, err := client.ListIPAddressesContext(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(ips))
+
+	require.NoError(t, client.ReleaseIPAddressContext(ctx, &machines.ReleaseIPAddressInput{IP: v6.IP}))
+
+	err = client.ReleaseIPAddressContext(ctx, &machines.ReleaseIPAddressInput{IP: v6.IP})
+	require.Equal(t, "ip address not found", err.Error())
+
+	ips, err = client.ListIPAddressesContext(ctx, &machines.ListIPAddressesInput{})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(ips))
+}
+
+func TestCertificates(t *testing.T) {
+	srv := testdata.Server("app")
+	defer srv.Close()
+
+	client := testClient(srv.URL)
+	ctx := context.Background()
+
+	_, err := client.AddCertificateContext(ctx, nil)
+	require.Equal(t, machines.ErrInputRequired, err)
+
+	_, err = client.AddCertificateContext(ctx, &machines.CertificateInput{})
+	require.Equal(t, machines.ErrHostnameRequired, err)
+
+	_, err = client.GetCertificateContext(ctx, &machines.CertificateInput{Hostname: "example.com"})
+	require.Equal(t, "certificate not found", err.Error())
+
+	cert, err := client.AddCertificateContext(ctx, &machines.CertificateInput{Hostname: "example.com"})
+	require.NoError(t, err)
+	require.False(t, cert.Configured)
+	require.Equal(t, "_acme-challenge.example.com", cert.DNSValidationHostname)
+
+	_, err = client.AddCertificateContext(ctx, &machines.CertificateInput{Hostname: "example.com"})
+	require.Equal(t, "hostname already exists", err.Error())
+
+	_, err = client.AddCertificateContext(ctx, &machines.CertificateInput{Hostname: "invalid.example.com"})
+	require.NoError(t, err)
+
+	cert, err = client.CheckCertificateContext(ctx, &machines.CertificateInput{Hostname: "example.com"})
+	require.NoError(t, err)
+	require.True(t, cert.Configured)
+	require.Equal(t, "Ready", cert.Status)
+
+	cert, err = client.CheckCertificateContext(ctx, &machines.CertificateInput{Hostname: "invalid.example.com"})
+	require.NoError(t, err)
+	require.False(t, cert.Configured)
+
+	cert, err = client.GetCertificateContext(ctx, &machines.CertificateInput{Hostname: "example.com"})
+	require.NoError(t, err)
+	require.True(t, cert.Configured)
+
+	certs, err := client.ListCertificatesContext(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(certs))
+
+	require.NoError(t, client.DeleteCertificateContext(ctx, &machines.CertificateInput{Hostname: "example.com"}))
+
+	err = client.DeleteCertificateContext(ctx, &machines.CertificateInput{Hostname: "example.com"})
+	require.Equal(t, "certificate not found", err.Error())
+}
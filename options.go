@@ -0,0 +1,105 @@
+package machines
+
+import (
+	"net/http"
+)
+
+// Option configures the client at construction time
+type Option func(*Client)
+
+// TransportMiddleware wraps the HTTP transport, e.g. to log or modify requests
+type TransportMiddleware func(http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc adapts a function to http.RoundTripper
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (fn RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
+
+// WithHTTPClient sets the HTTP client used for API requests, http.DefaultClient by default
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Client) {
+		c.client = client
+	}
+}
+
+// WithTransport sets the transport of the HTTP client used for API requests
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *Client) {
+		c.transport = transport
+	}
+}
+
+// WithTransportMiddleware wraps the HTTP transport with middlewares. The first
+// middleware is the outermost one and sees the request first.
+func WithTransportMiddleware(middlewares ...TransportMiddleware) Option {
+	return func(c *Client) {
+		c.middlewares = append(c.middlewares, middlewares...)
+	}
+}
+
+// WithBaseURL sets the API base URL, FLY_API_HOSTNAME env var is used by default
+func WithBaseURL(url string) Option {
+	return func(c *Client) {
+		c.baseURL = url
+	}
+}
+
+// WithToken sets the API token, FLY_API_TOKEN env var is used by default
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.apiToken = token
+	}
+}
+
+// WithUserAgent appends the suffix to the default user agent
+func WithUserAgent(suffix string) Option {
+	return func(c *Client) {
+		c.userAgent = ClientVersion() + " " + suffix
+	}
+}
+
+// WithHeader adds the header to every API request
+func WithHeader(key string, value string) Option {
+	return func(c *Client) {
+		c.headers.Add(key, value)
+	}
+}
+
+// WithRetryPolicy enables request retries
+func WithRetryPolicy(policy *RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// WithRateLimiter enables client-side rate limiting
+func WithRateLimiter(limiter *RateLimiter) Option {
+	return func(c *Client) {
+		c.limiter = limiter
+	}
+}
+
+// buildHTTPClient returns a copy of the configured HTTP client using the
+// configured transport wrapped with middlewares
+func (c *Client) buildHTTPClient() *http.Client {
+	if c.transport == nil && len(c.middlewares) == 0 {
+		return c.client
+	}
+
+	transport := c.transport
+	if transport == nil {
+		transport = c.client.Transport
+	}
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	for i := len(c.middlewares) - 1; i >= 0; i-- {
+		transport = c.middlewares[i](transport)
+	}
+
+	client := *c.client
+	client.Transport = transport
+	return &client
+}
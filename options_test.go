@@ -0,0 +1,67 @@
+package machines_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	machines "github.com/sosedoff/fly-machines"
+	"github.com/sosedoff/fly-machines/testdata"
+)
+
+func TestNewClientOptions(t *testing.T) {
+	srv := testdata.Server("app", "other")
+	defer srv.Close()
+
+	var (
+		seen  *http.Request
+		order []string
+	)
+	middleware := func(name string) machines.TransportMiddleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return machines.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				seen = req
+				return next.RoundTrip(req)
+			})
+		}
+	}
+
+	client := machines.NewClient("app",
+		machines.WithBaseURL(srv.URL),
+		machines.WithToken("api_token"),
+		machines.WithUserAgent("myapp/1.0"),
+		machines.WithHeader("X-Source", "test"),
+		machines.WithHTTPClient(&http.Client{}),
+		machines.WithTransportMiddleware(middleware("outer"), middleware("inner")),
+	)
+	require.Equal(t, srv.URL, client.GetBaseURL())
+
+	_, err := client.GetContext(context.Background(), &machines.GetInput{ID: "1"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"outer", "inner"}, order)
+	require.Equal(t, "Bearer api_token", seen.Header.Get("Authorization"))
+	require.Equal(t, "test", seen.Header.Get("X-Source"))
+	require.True(t, strings.HasSuffix(seen.Header.Get("User-Agent"), " myapp/1.0"))
+}
+
+func TestNewClientWithToken(t *testing.T) {
+	srv := testdata.Server("app", "other")
+	defer srv.Close()
+
+	var auth string
+	client := machines.NewClientWithToken("app", "api_token",
+		machines.WithBaseURL(srv.URL),
+		machines.WithTransport(machines.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			auth = req.Header.Get("Authorization")
+			return http.DefaultTransport.RoundTrip(req)
+		})),
+	)
+
+	_, err := client.GetContext(context.Background(), &machines.GetInput{ID: "1"})
+	require.NoError(t, err)
+	require.Equal(t, "Bearer api_token", auth)
+}
@@ -0,0 +1,196 @@
+package machines
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit defines the token bucket budget. Zero rate means no limit.
+type RateLimit struct {
+	Rate  float64 // Requests per second
+	Burst int     // Max number of requests allowed at once
+}
+
+// RateLimiterConfig defines separate budgets for read and mutating requests,
+// both for all requests made by the client and for each app.
+type RateLimiterConfig struct {
+	Read        RateLimit
+	Write       RateLimit
+	PerAppRead  RateLimit
+	PerAppWrite RateLimit
+}
+
+// RateLimiter throttles API requests before they are sent. It is safe to share
+// between goroutines and clients, so they all stay within the same budget.
+// The limiter also pauses the requests when the API reports the limit is hit.
+type RateLimiter struct {
+	config RateLimiterConfig
+	global [2]*bucket
+	apps   map[string]*[2]*bucket
+	mu     sync.Mutex
+}
+
+const (
+	budgetRead  = 0
+	budgetWrite = 1
+)
+
+func NewRateLimiter(config RateLimiterConfig) *RateLimiter {
+	return &RateLimiter{
+		config: config,
+		global: [2]*bucket{newBucket(config.Read), newBucket(config.Write)},
+		apps:   map[string]*[2]*bucket{},
+	}
+}
+
+// SetRateLimiter enables client-side rate limiting, or disables it when limiter is nil
+func (c *Client) SetRateLimiter(limiter *RateLimiter) {
+	c.limiter = limiter
+}
+
+// Wait blocks until the request for the app is allowed or the context is done
+func (l *RateLimiter) Wait(ctx context.Context, appName string, mutating bool) error {
+	buckets := l.buckets(appName, mutating)
+
+	now := time.Now()
+	delay := time.Duration(0)
+	for _, b := range buckets {
+		if wait := b.reserve(now); wait > delay {
+			delay = wait
+		}
+	}
+	if delay == 0 {
+		return nil
+	}
+
+	if err := sleepContext(ctx, delay); err != nil {
+		for _, b := range buckets {
+			b.cancel()
+		}
+		return err
+	}
+	return nil
+}
+
+// observe pauses the app budget when the response indicates the limit is reached
+func (l *RateLimiter) observe(appName string, mutating bool, resp *http.Response) {
+	limited := resp.StatusCode == http.StatusTooManyRequests ||
+		strings.TrimSpace(resp.Header.Get("RateLimit-Remaining")) == "0"
+	if !limited {
+		return
+	}
+
+	delay, ok := retryAfter(resp.Header)
+	if !ok {
+		delay = time.Second
+	}
+
+	until := time.Now().Add(delay)
+	for _, b := range l.buckets(appName, mutating) {
+		b.pause(until)
+	}
+}
+
+func (l *RateLimiter) buckets(appName string, mutating bool) []*bucket {
+	kind := budgetRead
+	if mutating {
+		kind = budgetWrite
+	}
+
+	result := []*bucket{l.global[kind]}
+	if appName == "" {
+		return result
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	app, ok := l.apps[appName]
+	if !ok {
+		app = &[2]*bucket{newBucket(l.config.PerAppRead), newBucket(l.config.PerAppWrite)}
+		l.apps[appName] = app
+	}
+
+	return append(result, app[kind])
+}
+
+// bucket is a token bucket that allows going into debt, so waiting callers are
+// served in order of arrival
+type bucket struct {
+	limit       RateLimit
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+	mu          sync.Mutex
+}
+
+func newBucket(limit RateLimit) *bucket {
+	if limit.Burst <= 0 {
+		limit.Burst = 1
+	}
+	return &bucket{limit: limit, tokens: float64(limit.Burst)}
+}
+
+// reserve takes a token and returns how long to wait before using it
+func (b *bucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var wait time.Duration
+	if now.Before(b.pausedUntil) {
+		wait = b.pausedUntil.Sub(now)
+	}
+	if b.limit.Rate <= 0 {
+		return wait
+	}
+
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.limit.Rate
+		if burst := float64(b.limit.Burst); b.tokens > burst {
+			b.tokens = burst
+		}
+	}
+	b.last = now
+	b.tokens--
+
+	if b.tokens < 0 {
+		tokenWait := time.Duration(-b.tokens / b.limit.Rate * float64(time.Second))
+		if tokenWait > wait {
+			wait = tokenWait
+		}
+	}
+	return wait
+}
+
+// cancel returns the reserved token back to the bucket
+func (b *bucket) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.limit.Rate > 0 {
+		b.tokens++
+	}
+}
+
+// pause blocks all requests until the given time
+func (b *bucket) pause(until time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if until.After(b.pausedUntil) {
+		b.pausedUntil = until
+	}
+}
+
+// appNameFromPath extracts the app name from the request path, if present
+func appNameFromPath(path string) string {
+	_, rest, found := strings.Cut(path, "/v1/apps/")
+	if !found {
+		return ""
+	}
+	name, _, _ := strings.Cut(rest, "/")
+	return name
+}
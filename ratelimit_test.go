@@ -0,0 +1,100 @@
+package machines_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	machines "github.com/sosedoff/fly-machines"
+	"github.com/sosedoff/fly-machines/testdata"
+)
+
+func TestRateLimiter(t *testing.T) {
+	srv := testdata.Server("app", "other")
+	defer srv.Close()
+
+	client := testClient(srv.URL)
+	client.SetRateLimiter(machines.NewRateLimiter(machines.RateLimiterConfig{
+		PerAppWrite: machines.RateLimit{Rate: 5, Burst: 1},
+	}))
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, client.StopContext(ctx, &machines.StopInput{ID: "1"}))
+	}
+	require.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+
+	// Reads and other apps have separate budgets
+	start = time.Now()
+	for i := 0; i < 3; i++ {
+		_, err := client.GetContext(ctx, &machines.GetInput{ID: "1"})
+		require.NoError(t, err)
+	}
+	require.NoError(t, client.StopContext(ctx, &machines.StopInput{ID: "1", AppName: "other"}))
+	require.Less(t, time.Since(start), 150*time.Millisecond)
+}
+
+func TestRateLimiterConcurrency(t *testing.T) {
+	srv := testdata.Server("app", "other")
+	defer srv.Close()
+
+	// Global budget is shared by all clients and goroutines
+	limiter := machines.NewRateLimiter(machines.RateLimiterConfig{
+		Read: machines.RateLimit{Rate: 50, Burst: 2},
+	})
+	clients := []*machines.Client{testClient(srv.URL), testClient(srv.URL)}
+	for _, c := range clients {
+		c.SetRateLimiter(limiter)
+	}
+
+	start := time.Now()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 12; i++ {
+		wg.Add(1)
+		go func(client *machines.Client) {
+			defer wg.Done()
+			_, err := client.GetContext(context.Background(), &machines.GetInput{ID: "1", AppName: "other"})
+			require.NoError(t, err)
+		}(clients[i%2])
+	}
+	wg.Wait()
+
+	require.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+}
+
+func TestRateLimiterContext(t *testing.T) {
+	limiter := machines.NewRateLimiter(machines.RateLimiterConfig{
+		Write: machines.RateLimit{Rate: 1, Burst: 1},
+	})
+
+	require.NoError(t, limiter.Wait(context.Background(), "app", true))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.Equal(t, context.DeadlineExceeded, limiter.Wait(ctx, "app", true))
+
+	// Unlimited budgets never block
+	require.NoError(t, limiter.Wait(ctx, "app", false))
+}
+
+func TestRateLimiterAdapts(t *testing.T) {
+	srv := testdata.Server("app")
+	defer srv.Close()
+
+	limiter := machines.NewRateLimiter(machines.RateLimiterConfig{})
+	client := testClient(srv.URL)
+	client.SetRateLimiter(limiter)
+
+	// API responds with Retry-After: 1
+	_, err := client.GetContext(context.Background(), &machines.GetInput{ID: "flaky-1-429-a"})
+	require.Equal(t, "transient failure 1", err.Error())
+
+	start := time.Now()
+	_, err = client.GetContext(context.Background(), &machines.GetInput{ID: "1"})
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, time.Since(start), 900*time.Millisecond)
+}
@@ -1,16 +1,23 @@
 package machines
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"unicode/utf8"
 )
 
-// APIError is a generic error response container
+// APIError is a generic error response container. It matches the error class
+// of the response status with errors.Is, e.g. errors.Is(err, ErrNotFound).
 type APIError struct {
 	StatusCode   int               `json:"-"`
 	ErrorMessage string            `json:"error"`
 	Headers      map[string]string `json:"-"`
+	Operation    string            `json:"-"` // Operation of the failed call, see Call
+	MachineID    string            `json:"-"` // Machine ID, if the call targeted a machine
 
 	rawBody []byte
 }
@@ -23,6 +30,88 @@ func (err APIError) Error() string {
 	return err.ErrorMessage
 }
 
+func (err APIError) Is(target error) bool {
+	return target != nil && target == err.class()
+}
+
+// class returns the sentinel error for the response status
+func (err APIError) class() error {
+	switch {
+	case err.StatusCode == http.StatusUnauthorized, err.StatusCode == http.StatusForbidden:
+		return ErrInvalidAuth
+	case err.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case err.StatusCode == http.StatusConflict:
+		return ErrConflict
+	case err.StatusCode == http.StatusPreconditionFailed:
+		return ErrPreconditionFailed
+	case err.StatusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case err.StatusCode == http.StatusBadRequest, err.StatusCode == http.StatusUnprocessableEntity:
+		return ErrValidation
+	case err.StatusCode >= 500:
+		return ErrServerError
+	default:
+		return nil
+	}
+}
+
+// RequestID returns the Fly request ID of the failed request, if present
+func (err APIError) RequestID() string {
+	for k, v := range err.Headers {
+		if strings.EqualFold(k, requestIDHeader) {
+			return v
+		}
+	}
+	return ""
+}
+
+// VersionConflictError is returned when machine update is based on a stale version
+type VersionConflictError struct {
+	MachineID string
+	Version   string
+	Err       APIError
+}
+
+func (err VersionConflictError) Error() string {
+	return fmt.Sprintf("machine %s version conflict: %s", err.MachineID, err.Err.Error())
+}
+
+func (err VersionConflictError) Unwrap() error {
+	return err.Err
+}
+
+// LeaseHeldError is returned when the machine is leased by someone else
+type LeaseHeldError struct {
+	MachineID string
+	Err       APIError
+}
+
+func (err LeaseHeldError) Error() string {
+	return err.Err.Error()
+}
+
+func (err LeaseHeldError) Unwrap() error {
+	return err.Err
+}
+
+func (err LeaseHeldError) Is(target error) bool {
+	return target == ErrLeaseHeld
+}
+
+func isVersionConflict(err APIError) bool {
+	return err.StatusCode == http.StatusPreconditionFailed
+}
+
+// isLeaseConflict returns true if the machine request was rejected because the
+// machine is leased by someone else
+func isLeaseConflict(err APIError) bool {
+	return err.StatusCode == http.StatusConflict && strings.Contains(strings.ToLower(err.ErrorMessage), "lease")
+}
+
+// maxErrorMessageLength limits the message taken from plain text error bodies
+const maxErrorMessageLength = 512
+
 func apiErrorFromResponse(resp *http.Response) error {
 	apiErr := APIError{
 		StatusCode: resp.StatusCode,
@@ -31,7 +120,7 @@ func apiErrorFromResponse(resp *http.Response) error {
 
 	// We copy all the headers instead of just FLY_* ones for debugging
 	for k, v := range resp.Header {
-		apiErr.Headers[k] = v[0]
+		apiErr.Headers[k] = strings.Join(v, ", ")
 	}
 
 	body, err := io.ReadAll(resp.Body)
@@ -39,13 +128,95 @@ func apiErrorFromResponse(resp *http.Response) error {
 		return err
 	}
 	apiErr.rawBody = body
+	apiErr.ErrorMessage = errorMessageFromBody(body)
 
-	// Check if body looks like JSON first
-	if body[0] == '{' {
-		if err := json.Unmarshal(body, &apiErr); err != nil {
-			return err
-		}
+	if apiErr.ErrorMessage == "" {
+		apiErr.ErrorMessage = strings.ToLower(http.StatusText(resp.StatusCode))
+	}
+	if apiErr.ErrorMessage == "" {
+		apiErr.ErrorMessage = fmt.Sprintf("unexpected status %d", resp.StatusCode)
 	}
 
 	return apiErr
 }
+
+// errorMessageFromBody extracts the error message from JSON, HTML or plain text
+// response body. Returns an empty string if there is no usable message.
+func errorMessageFromBody(body []byte) string {
+	text := strings.TrimSpace(string(body))
+	if text == "" {
+		return ""
+	}
+
+	switch text[0] {
+	case '{', '[':
+		var data any
+		if err := json.Unmarshal([]byte(text), &data); err == nil {
+			return truncateMessage(jsonErrorMessage(data))
+		}
+	case '<':
+		return truncateMessage(htmlTitle(text))
+	}
+
+	return truncateMessage(text)
+}
+
+// jsonErrorMessage finds the message in common error formats, such as
+// {"error": "..."}, {"error": {"message": "..."}} or {"errors": ["..."]}
+func jsonErrorMessage(data any) string {
+	switch val := data.(type) {
+	case string:
+		return strings.TrimSpace(val)
+	case []any:
+		messages := []string{}
+		for _, item := range val {
+			if msg := jsonErrorMessage(item); msg != "" {
+				messages = append(messages, msg)
+			}
+		}
+		return strings.Join(messages, "; ")
+	case map[string]any:
+		for _, key := range []string{"error", "message", "errors", "detail", "error_description"} {
+			if msg := jsonErrorMessage(val[key]); msg != "" {
+				return msg
+			}
+		}
+	}
+	return ""
+}
+
+// htmlTitle returns the title of the HTML page, such as proxy error pages
+func htmlTitle(text string) string {
+	// Only ASCII letters are lowered so the offsets match the original text
+	lower := []byte(text)
+	for i, c := range lower {
+		if 'A' <= c && c <= 'Z' {
+			lower[i] = c + 'a' - 'A'
+		}
+	}
+
+	start := bytes.Index(lower, []byte("<title>"))
+	if start < 0 {
+		return ""
+	}
+	start += len("<title>")
+
+	end := bytes.Index(lower[start:], []byte("</title>"))
+	if end < 0 {
+		return ""
+	}
+	return strings.Join(strings.Fields(text[start:start+end]), " ")
+}
+
+func truncateMessage(msg string) string {
+	msg = strings.ToValidUTF8(msg, "")
+	if len(msg) <= maxErrorMessageLength {
+		return msg
+	}
+	msg = msg[:maxErrorMessageLength]
+	// Do not cut a multi-byte character in half
+	for len(msg) > 0 && !utf8.ValidString(msg) {
+		msg = msg[:len(msg)-1]
+	}
+	return msg + "..."
+}
@@ -1,10 +1,13 @@
 package machines
 
 import (
+	"bytes"
 	"io"
 	"net/http"
 	"os"
+	"strings"
 	"testing"
+	"unicode/utf8"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -37,6 +40,7 @@ func Test_apiErrorFromResponse(t *testing.T) {
 		assert.Equal(t, "invalid machine ID, '12345'", apiErr.ErrorMessage)
 		assert.Contains(t, string(apiErr.rawBody), `{"error": "invalid machine ID, '12345'"}`)
 		assert.Equal(t, "req-id", apiErr.Headers["fly-request-id"])
+		assert.Equal(t, "req-id", apiErr.RequestID())
 		assert.Equal(t, "trace-id", apiErr.Headers["fly-trace-id"])
 		assert.Equal(t, "server: Fly/620fe63b (2023-03-17)", apiErr.Headers["via"])
 	})
@@ -52,7 +56,112 @@ func Test_apiErrorFromResponse(t *testing.T) {
 
 		apiErr := err.(APIError)
 		assert.Equal(t, 400, apiErr.StatusCode)
-		assert.Equal(t, "", apiErr.ErrorMessage) // TODO: set error from the body?
+		assert.Equal(t, "not found", apiErr.ErrorMessage)
 		assert.Contains(t, string(apiErr.rawBody), `not found`)
 	})
+
+	t.Run("other bodies", func(t *testing.T) {
+		examples := []struct {
+			status  int
+			body    string
+			message string
+		}{
+			{502, "", "bad gateway"},
+			{503, " \n\t", "service unavailable"},
+			{599, "", "unexpected status 599"},
+			{502, "<html><head><TITLE>502 Bad\n Gateway</TITLE></head><body>nginx</body></html>", "502 Bad Gateway"},
+			{502, "<html><body>nginx</body></html>", "bad gateway"},
+			{400, `{"error": {"message": "invalid config", "code": 42}}`, "invalid config"},
+			{422, `{"errors": ["name is required", {"detail": "region is invalid"}]}`, "name is required; region is invalid"},
+			{400, `{"message": "bad request"}`, "bad request"},
+			{400, `{"error": "truncated`, `{"error": "truncated`},
+			{400, `{"code": 42}`, "bad request"},
+			{500, strings.Repeat("x", 1000), strings.Repeat("x", 512) + "..."},
+		}
+
+		for _, ex := range examples {
+			err := apiErrorFromResponse(&http.Response{
+				StatusCode: ex.status,
+				Body:       io.NopCloser(strings.NewReader(ex.body)),
+			})
+
+			apiErr, ok := err.(APIError)
+			assert.True(t, ok, ex.body)
+			assert.Equal(t, ex.message, apiErr.ErrorMessage, ex.body)
+			assert.Equal(t, ex.body, apiErr.RawBody())
+		}
+	})
+
+	t.Run("multi-value headers", func(t *testing.T) {
+		err := apiErrorFromResponse(&http.Response{
+			StatusCode: 503,
+			Header:     http.Header{"Via": {"1.1 fly.io", "1.1 proxy"}},
+			Body:       io.NopCloser(strings.NewReader("")),
+		})
+		assert.Equal(t, "1.1 fly.io, 1.1 proxy", err.(APIError).Headers["Via"])
+	})
+}
+
+func FuzzAPIErrorFromResponse(f *testing.F) {
+	f.Add(400, []byte(`{"error": "invalid machine ID, '12345'"}`))
+	f.Add(400, []byte(`{"error": {"message": "nested"}}`))
+	f.Add(422, []byte(`{"errors": [{"detail": "a"}, "b", 1, null]}`))
+	f.Add(502, []byte("<html><title>502 Bad Gateway</title></html>"))
+	f.Add(502, []byte("<TITLE>\xc4\xb0\xff</title>"))
+	f.Add(503, []byte(""))
+	f.Add(500, []byte("not found"))
+	f.Add(0, []byte("[[[[[[[[[["))
+	f.Add(-1, []byte("{\"error\":\"\xff\xfe\"}"))
+
+	f.Fuzz(func(t *testing.T, status int, body []byte) {
+		err := apiErrorFromResponse(&http.Response{
+			StatusCode: status,
+			Header:     http.Header{"Fly-Request-Id": {"a", "b"}},
+			Body:       io.NopCloser(bytes.NewReader(body)),
+		})
+
+		apiErr, ok := err.(APIError)
+		if !ok {
+			t.Fatalf("unexpected error type %T", err)
+		}
+		if apiErr.ErrorMessage == "" {
+			t.Fatal("error message is empty")
+		}
+		if len(apiErr.ErrorMessage) > maxErrorMessageLength+len("...") {
+			t.Fatalf("error message is too long: %d", len(apiErr.ErrorMessage))
+		}
+		if !utf8.ValidString(apiErr.ErrorMessage) {
+			t.Fatalf("error message is not valid utf-8: %q", apiErr.ErrorMessage)
+		}
+	})
+}
+
+func TestAPIErrorIs(t *testing.T) {
+	examples := []struct {
+		status int
+		target error
+	}{
+		{http.StatusBadRequest, ErrValidation},
+		{http.StatusUnauthorized, ErrInvalidAuth},
+		{http.StatusNotFound, ErrNotFound},
+		{http.StatusConflict, ErrConflict},
+		{http.StatusPreconditionFailed, ErrPreconditionFailed},
+		{http.StatusUnprocessableEntity, ErrValidation},
+		{http.StatusTooManyRequests, ErrRateLimited},
+		{http.StatusServiceUnavailable, ErrServerError},
+	}
+
+	for _, ex := range examples {
+		err := APIError{StatusCode: ex.status}
+		assert.ErrorIs(t, err, ex.target, ex.status)
+		assert.NotErrorIs(t, err, ErrLeaseHeld, ex.status)
+	}
+
+	assert.ErrorIs(t, LeaseHeldError{Err: APIError{StatusCode: http.StatusConflict}}, ErrConflict)
+	assert.ErrorIs(t, VersionConflictError{Err: APIError{StatusCode: http.StatusPreconditionFailed}}, ErrPreconditionFailed)
+
+	assert.True(t, IsRetryable(APIError{StatusCode: http.StatusTooManyRequests}))
+	assert.True(t, IsRetryable(APIError{StatusCode: http.StatusBadGateway}))
+	assert.False(t, IsRetryable(APIError{StatusCode: http.StatusNotFound}))
+	assert.False(t, IsNotFound(APIError{StatusCode: http.StatusConflict}))
 }
@@ -0,0 +1,204 @@
+package machines
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy controls how failed requests are retried.
+//
+// Requests are retried on network errors and 429/5xx responses. Non-idempotent
+// requests, such as machine creation, are only retried when the API did not
+// process them: on connection failures and rate limit responses.
+type RetryPolicy struct {
+	MaxAttempts int           // Total number of attempts, including the first one
+	MinDelay    time.Duration // Delay before the first retry, doubled after each attempt
+	MaxDelay    time.Duration // Upper limit for the delay between attempts
+}
+
+// DefaultRetryPolicy returns a reasonable policy for most API clients
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: 3,
+		MinDelay:    250 * time.Millisecond,
+		MaxDelay:    5 * time.Second,
+	}
+}
+
+// idempotentActions are POST machine actions that are safe to repeat. Start and
+// lease are excluded: a repeated start fails on the started machine, and
+// a repeated lease request could conflict with the lease taken by the first one.
+var idempotentActions = map[string]bool{
+	"stop":     true,
+	"suspend":  true,
+	"cordon":   true,
+	"uncordon": true,
+}
+
+// SetRetryPolicy enables request retries, or disables them when policy is nil
+func (c *Client) SetRetryPolicy(policy *RetryPolicy) {
+	c.retry = policy
+}
+
+// shouldRetry returns true if the request could be retried after the given result
+func (p *RetryPolicy) shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+	if req.Body != nil && req.GetBody == nil {
+		return false
+	}
+
+	if err != nil {
+		return isDialError(err) || isIdempotent(req)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return isIdempotent(req)
+	default:
+		return false
+	}
+}
+
+// delay returns how long to wait before the next attempt. Server provided delay
+// takes precedence over the exponential backoff, both are limited by MaxDelay.
+func (p *RetryPolicy) delay(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if delay, ok := retryAfter(resp.Header); ok {
+			if p.MaxDelay > 0 && delay > p.MaxDelay {
+				return p.MaxDelay
+			}
+			return delay
+		}
+	}
+
+	delay := p.MinDelay << (attempt - 1)
+	if p.MaxDelay > 0 && (delay <= 0 || delay > p.MaxDelay) {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	// Jitter within [delay/2, delay] so concurrent clients do not retry in sync
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// do performs the call request, retrying it according to the client's retry policy.
+// Each attempt waits for the rate limiter, if any.
+func (c *Client) do(call *Call) (*http.Response, error) {
+	req := call.Request
+	appName := appNameFromPath(req.URL.Path)
+	mutating := req.Method != http.MethodGet && req.Method != http.MethodHead
+
+	for attempt := 1; ; attempt++ {
+		call.Attempts = attempt
+		if c.limiter != nil {
+			if err := c.limiter.Wait(req.Context(), appName, mutating); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := c.client.Do(req)
+		if c.limiter != nil && resp != nil {
+			c.limiter.observe(appName, mutating, resp)
+		}
+
+		policy := c.retry
+		if policy == nil || attempt >= policy.MaxAttempts || !policy.shouldRetry(req, resp, err) {
+			return resp, err
+		}
+
+		delay := policy.delay(attempt, resp)
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		if err := sleepContext(req.Context(), delay); err != nil {
+			return nil, err
+		}
+
+		req, err = rewindRequest(req)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func rewindRequest(req *http.Request) (*http.Request, error) {
+	next := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		next.Body = body
+	}
+	return next, nil
+}
+
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	case http.MethodPost:
+		action := req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:]
+		return machineIDFromPath(req.URL.Path) != "" && idempotentActions[action]
+	default:
+		return false
+	}
+}
+
+// isDialError returns true if connection to the server was never established
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// retryAfter parses the server provided retry delay from Retry-After header,
+// in seconds or HTTP date format, or from the RateLimit-Reset header.
+func retryAfter(header http.Header) (time.Duration, bool) {
+	if val := header.Get("Retry-After"); val != "" {
+		if secs, err := strconv.Atoi(val); err == nil && secs >= 0 {
+			return time.Duration(secs) * time.Second, true
+		}
+		if t, err := http.ParseTime(val); err == nil {
+			if delay := time.Until(t); delay > 0 {
+				return delay, true
+			}
+			return 0, true
+		}
+	}
+
+	if val := header.Get("RateLimit-Reset"); val != "" {
+		if secs, err := strconv.Atoi(val); err == nil && secs >= 0 {
+			return time.Duration(secs) * time.Second, true
+		}
+	}
+
+	return 0, false
+}
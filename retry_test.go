@@ -0,0 +1,100 @@
+package machines_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	machines "github.com/sosedoff/fly-machines"
+	"github.com/sosedoff/fly-machines/testdata"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	srv := testdata.Server("app")
+	defer srv.Close()
+
+	client := testClient(srv.URL)
+	ctx := context.Background()
+
+	// Retries are disabled by default
+	_, err := client.GetContext(ctx, &machines.GetInput{ID: "flaky-1-503-a"})
+	require.Equal(t, "transient failure 1", err.Error())
+
+	client.SetRetryPolicy(&machines.RetryPolicy{
+		MaxAttempts: 3,
+		MinDelay:    time.Millisecond,
+		MaxDelay:    10 * time.Millisecond,
+	})
+
+	machine, err := client.GetContext(ctx, &machines.GetInput{ID: "flaky-2-503-b"})
+	require.NoError(t, err)
+	require.Equal(t, "4d89040f431938", machine.ID)
+
+	_, err = client.GetContext(ctx, &machines.GetInput{ID: "flaky-3-502-c"})
+	require.Equal(t, "transient failure 3", err.Error())
+
+	// Client errors are not retried
+	_, err = client.GetContext(ctx, &machines.GetInput{ID: "flaky-1-400-d"})
+	require.Equal(t, "transient failure 1", err.Error())
+
+	// Idempotent actions are retried
+	err = client.StopContext(ctx, &machines.StopInput{ID: "flaky-1-503-e", Signal: machines.SignalTERM})
+	require.NoError(t, err)
+
+	err = client.DeleteContext(ctx, &machines.DeleteInput{ID: "flaky-1-504-f"})
+	require.NoError(t, err)
+
+	// Non-idempotent actions are not retried on server errors
+	err = client.RestartContext(ctx, &machines.RestartInput{ID: "flaky-1-503-g"})
+	require.Equal(t, "transient failure 1", err.Error())
+
+	_, err = client.ExecContext(ctx, &machines.ExecInput{ID: "flaky-1-500-h", Command: []string{"echo"}})
+	require.Equal(t, "transient failure 1", err.Error())
+
+	// Start and lease requests are not retried on server errors
+	_, err = client.StartContext(ctx, &machines.StartInput{ID: "flaky-1-503-k"})
+	require.Equal(t, "transient failure 1", err.Error())
+
+	_, err = client.LeaseContext(ctx, &machines.LeaseInput{ID: "flaky-1-503-l"})
+	require.Equal(t, "transient failure 1", err.Error())
+
+	// Server provided delay is limited by MaxDelay
+	start := time.Now()
+	err = client.RestartContext(ctx, &machines.RestartInput{ID: "flaky-1-429-m"})
+	require.NoError(t, err)
+	require.Less(t, time.Since(start), 500*time.Millisecond)
+
+	// Rate limited requests are retried after the server provided delay
+	client.SetRetryPolicy(&machines.RetryPolicy{MaxAttempts: 3, MaxDelay: 2 * time.Second})
+	start = time.Now()
+	err = client.RestartContext(ctx, &machines.RestartInput{ID: "flaky-1-429-i"})
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, time.Since(start), time.Second)
+
+	// Waiting for the retry respects the context
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	err = client.RestartContext(ctx, &machines.RestartInput{ID: "flaky-1-429-j"})
+	require.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestDefaultRetryPolicy(t *testing.T) {
+	policy := machines.DefaultRetryPolicy()
+	policy.MaxAttempts = 10
+
+	require.Equal(t, 3, machines.DefaultRetryPolicy().MaxAttempts)
+}
+
+func TestRetryPolicyConnectionError(t *testing.T) {
+	srv := testdata.Server("app")
+	srv.Close()
+
+	client := testClient(srv.URL)
+	client.SetRetryPolicy(&machines.RetryPolicy{MaxAttempts: 2, MinDelay: time.Millisecond})
+
+	// Requests that never reached the server are safe to retry
+	_, err := client.CreateContext(context.Background(), &machines.CreateInput{Config: &machines.Config{}})
+	require.ErrorContains(t, err, "connection refused")
+}
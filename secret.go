@@ -0,0 +1,60 @@
+package machines
+
+import (
+	"strings"
+	"sync"
+)
+
+// RedactedValue replaces secret values in error messages and inspect output
+const RedactedValue = "[REDACTED]"
+
+// minRedactedLength is the length of the shortest redacted value. Shorter
+// values, such as "1" or "true", would redact unrelated parts of the output.
+const minRedactedLength = 6
+
+type Secret struct {
+	Name      string `json:"name"`
+	Digest    string `json:"digest"`
+	CreatedAt string `json:"created_at"`
+}
+
+// redactor keeps track of secret values known to the client
+type redactor struct {
+	values map[string]bool
+	mu     sync.RWMutex
+}
+
+func newRedactor() *redactor {
+	return &redactor{values: map[string]bool{}}
+}
+
+func (r *redactor) add(values ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, val := range values {
+		if len(val) >= minRedactedLength {
+			r.values[val] = true
+		}
+	}
+}
+
+// redact replaces all known secret values in the string
+func (r *redactor) redact(str string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for val := range r.values {
+		str = strings.ReplaceAll(str, val, RedactedValue)
+	}
+	return str
+}
+
+func (r *redactor) redactError(err APIError) APIError {
+	if r == nil {
+		return err
+	}
+	err.ErrorMessage = r.redact(err.ErrorMessage)
+	err.rawBody = []byte(r.redact(string(err.rawBody)))
+	return err
+}
@@ -0,0 +1,114 @@
+package testdata
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	machines "github.com/sosedoff/fly-machines"
+)
+
+const defaultOrgSlug = "personal"
+
+// appStore keeps track of apps served by the fake API
+type appStore struct {
+	apps   map[string]*machines.App
+	lastID int
+	sync.Mutex
+}
+
+func newAppStore(names []string) *appStore {
+	s := &appStore{apps: map[string]*machines.App{}}
+	for _, name := range names {
+		s.create(name, defaultOrgSlug)
+	}
+	return s
+}
+
+func (s *appStore) create(name string, orgSlug string) *machines.App {
+	s.lastID++
+
+	app := &machines.App{
+		ID:      fmt.Sprintf("app_%d", s.lastID),
+		Name:    name,
+		Status:  "pending",
+		Network: "default",
+		Organization: &machines.Organization{
+			Name: orgSlug,
+			Slug: orgSlug,
+		},
+	}
+	s.apps[name] = app
+
+	return app
+}
+
+func (s *appStore) requireApp(c *gin.Context) {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.apps[c.Param("app")]; !ok {
+		c.AbortWithStatusJSON(404, gin.H{"error": "app not found"})
+	}
+}
+
+func (s *appStore) routes(srv *gin.Engine, api *gin.RouterGroup) {
+	srv.GET("/v1/apps", func(c *gin.Context) {
+		s.Lock()
+		defer s.Unlock()
+
+		apps := []machines.App{}
+		for _, app := range s.apps {
+			if app.Organization.Slug == c.Query("org_slug") {
+				apps = append(apps, *app)
+			}
+		}
+		sort.Slice(apps, func(i, j int) bool { return apps[i].Name < apps[j].Name })
+
+		c.JSON(200, gin.H{"total_apps": len(apps), "apps": apps})
+	})
+
+	srv.POST("/v1/apps", func(c *gin.Context) {
+		input := machines.CreateAppInput{}
+		if err := c.BindJSON(&input); err != nil {
+			panic(err)
+		}
+		if err := input.Validate(); err != nil {
+			c.AbortWithStatusJSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		// App "conflict" simulates a concurrent operation on the app
+		if input.Name == "conflict" {
+			c.AbortWithStatusJSON(409, gin.H{"error": "app is being modified by another request"})
+			return
+		}
+
+		s.Lock()
+		defer s.Unlock()
+
+		if _, ok := s.apps[input.Name]; ok {
+			c.AbortWithStatusJSON(422, gin.H{"error": "app name is already taken"})
+			return
+		}
+		s.create(input.Name, input.OrgSlug)
+
+		c.Status(201)
+	})
+
+	api.GET("", func(c *gin.Context) {
+		s.Lock()
+		defer s.Unlock()
+
+		c.JSON(200, s.apps[c.Param("app")])
+	})
+
+	api.DELETE("", func(c *gin.Context) {
+		s.Lock()
+		defer s.Unlock()
+
+		delete(s.apps, c.Param("app"))
+		c.Status(202)
+	})
+}
@@ -0,0 +1,168 @@
+package testdata
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	machines "github.com/sosedoff/fly-machines"
+)
+
+// networkStore keeps track of IP addresses and certificates of all apps
+type networkStore struct {
+	ips    []machines.IPAddress
+	certs  map[string]*machines.Certificate
+	lastID int
+	sync.Mutex
+}
+
+func newNetworkStore() *networkStore {
+	return &networkStore{certs: map[string]*machines.Certificate{}}
+}
+
+func (s *networkStore) allocate(input machines.AllocateIPAddressInput) machines.IPAddress {
+	s.lastID++
+
+	ip := machines.IPAddress{
+		Type:        input.Type,
+		Region:      input.Region,
+		Network:     input.Network,
+		ServiceName: input.ServiceName,
+		CreatedAt:   "2023-03-22T04:07:43Z",
+	}
+	if ip.Region == "" {
+		ip.Region = "global"
+	}
+
+	switch input.Type {
+	case machines.IPAddressTypeV4:
+		ip.IP = fmt.Sprintf("137.66.0.%d", s.lastID)
+	case machines.IPAddressTypeSharedV4:
+		ip.IP = "66.241.124.1"
+		ip.Shared = true
+	case machines.IPAddressTypeV6:
+		ip.IP = fmt.Sprintf("2a09:8280:1::%d", s.lastID)
+	case machines.IPAddressTypePrivateV6:
+		ip.IP = fmt.Sprintf("fdaa:0:1::%d", s.lastID)
+	}
+
+	return ip
+}
+
+func (s *networkStore) routes(api *gin.RouterGroup) {
+	api.GET("/ip_assignments", func(c *gin.Context) {
+		s.Lock()
+		defer s.Unlock()
+
+		c.JSON(200, gin.H{"ips": s.ips})
+	})
+
+	api.POST("/ip_assignments", func(c *gin.Context) {
+		input := machines.AllocateIPAddressInput{}
+		if err := c.BindJSON(&input); err != nil {
+			panic(err)
+		}
+		if err := input.Validate(); err != nil {
+			c.AbortWithStatusJSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		s.Lock()
+		defer s.Unlock()
+
+		ip := s.allocate(input)
+		s.ips = append(s.ips, ip)
+
+		c.JSON(200, ip)
+	})
+
+	api.DELETE("/ip_assignments/:ip", func(c *gin.Context) {
+		s.Lock()
+		defer s.Unlock()
+
+		for i, ip := range s.ips {
+			if ip.IP == c.Param("ip") {
+				s.ips = append(s.ips[:i], s.ips[i+1:]...)
+				c.Status(204)
+				return
+			}
+		}
+		c.AbortWithStatusJSON(404, gin.H{"error": "ip address not found"})
+	})
+
+	requireCert := func(c *gin.Context) {
+		s.Lock()
+		defer s.Unlock()
+
+		if _, ok := s.certs[c.Param("hostname")]; !ok {
+			c.AbortWithStatusJSON(404, gin.H{"error": "certificate not found"})
+		}
+	}
+
+	api.GET("/certificates", func(c *gin.Context) {
+		s.Lock()
+		defer s.Unlock()
+
+		result := []machines.Certificate{}
+		for _, cert := range s.certs {
+			result = append(result, *cert)
+		}
+		c.JSON(200, gin.H{"certificates": result})
+	})
+
+	api.POST("/certificates/acme", func(c *gin.Context) {
+		input := machines.CertificateInput{}
+		if err := c.BindJSON(&input); err != nil {
+			panic(err)
+		}
+
+		s.Lock()
+		defer s.Unlock()
+
+		if _, ok := s.certs[input.Hostname]; ok {
+			c.AbortWithStatusJSON(422, gin.H{"error": "hostname already exists"})
+			return
+		}
+
+		cert := &machines.Certificate{
+			Hostname:              input.Hostname,
+			Status:                "Awaiting configuration",
+			DNSValidationHostname: "_acme-challenge." + input.Hostname,
+			DNSValidationTarget:   input.Hostname + ".flydns.net",
+			CreatedAt:             "2023-03-22T04:07:43Z",
+		}
+		s.certs[cert.Hostname] = cert
+
+		c.JSON(200, cert)
+	})
+
+	api.GET("/certificates/:hostname", requireCert, func(c *gin.Context) {
+		s.Lock()
+		defer s.Unlock()
+
+		c.JSON(200, s.certs[c.Param("hostname")])
+	})
+
+	// Hostnames starting with "invalid." never pass DNS validation
+	api.POST("/certificates/:hostname/check", requireCert, func(c *gin.Context) {
+		s.Lock()
+		defer s.Unlock()
+
+		cert := s.certs[c.Param("hostname")]
+		if !strings.HasPrefix(cert.Hostname, "invalid.") {
+			cert.Configured = true
+			cert.Status = "Ready"
+		}
+
+		c.JSON(200, cert)
+	})
+
+	api.DELETE("/certificates/:hostname", requireCert, func(c *gin.Context) {
+		s.Lock()
+		defer s.Unlock()
+
+		delete(s.certs, c.Param("hostname"))
+		c.Status(204)
+	})
+}
@@ -0,0 +1,84 @@
+package testdata
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	machines "github.com/sosedoff/fly-machines"
+)
+
+var secretNameFormat = regexp.MustCompile(`^[A-Z_][A-Z0-9_]*$`)
+
+// secretStore keeps secret values for each app
+type secretStore struct {
+	secrets map[string]map[string]string
+	sync.Mutex
+}
+
+func newSecretStore() *secretStore {
+	return &secretStore{secrets: map[string]map[string]string{}}
+}
+
+func (s *secretStore) routes(api *gin.RouterGroup) {
+	api.GET("/secrets", func(c *gin.Context) {
+		s.Lock()
+		defer s.Unlock()
+
+		result := []machines.Secret{}
+		for name, val := range s.secrets[c.Param("app")] {
+			result = append(result, machines.Secret{
+				Name:      name,
+				Digest:    fmt.Sprintf("%x", sha256.Sum256([]byte(val)))[:16],
+				CreatedAt: "2023-03-22T04:07:43Z",
+			})
+		}
+		sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+
+		c.JSON(200, gin.H{"secrets": result})
+	})
+
+	api.POST("/secrets", func(c *gin.Context) {
+		input := machines.SetSecretsInput{}
+		if err := c.BindJSON(&input); err != nil {
+			panic(err)
+		}
+
+		// Error message includes the value on purpose to test redaction
+		for name, val := range input.Values {
+			if !secretNameFormat.MatchString(name) {
+				c.AbortWithStatusJSON(400, gin.H{"error": fmt.Sprintf("invalid secret name %q for value %q", name, val)})
+				return
+			}
+		}
+
+		s.Lock()
+		defer s.Unlock()
+
+		app := c.Param("app")
+		if s.secrets[app] == nil {
+			s.secrets[app] = map[string]string{}
+		}
+		for name, val := range input.Values {
+			s.secrets[app][name] = val
+		}
+
+		c.Status(201)
+	})
+
+	api.DELETE("/secrets/:name", func(c *gin.Context) {
+		s.Lock()
+		defer s.Unlock()
+
+		if _, ok := s.secrets[c.Param("app")][c.Param("name")]; !ok {
+			c.AbortWithStatusJSON(404, gin.H{"error": "secret not found"})
+			return
+		}
+		delete(s.secrets[c.Param("app")], c.Param("name"))
+
+		c.Status(204)
+	})
+}
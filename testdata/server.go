@@ -1,19 +1,52 @@
 package testdata
 
 import (
+	"embed"
+	"encoding/json"
+	"fmt"
 	"net/http/httptest"
-	"os"
-	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	machines "github.com/sosedoff/fly-machines"
 )
 
-func Server(appName string) *httptest.Server {
+// Server returns a fake API server that serves machines for all given apps
+func Server(appNames ...string) *httptest.Server {
 	srv := gin.New()
 	srv.Use(func(c *gin.Context) {
 		c.Header("Content-Type", "application/json")
+		c.Header("Fly-Request-Id", "req-"+c.Request.Method)
+	})
+
+	// Machine IDs formatted as "flaky-<count>-<status>[-<suffix>]" fail the first
+	// <count> requests to the same path with <status>, status 429 includes Retry-After
+	attempts := map[string]int{}
+	attemptsLock := sync.Mutex{}
+	srv.Use(func(c *gin.Context) {
+		parts := strings.Split(machineIDFromPath(c.Request.URL.Path), "-")
+		if len(parts) < 3 || parts[0] != "flaky" {
+			return
+		}
+		count, _ := strconv.Atoi(parts[1])
+		status, _ := strconv.Atoi(parts[2])
+
+		attemptsLock.Lock()
+		key := c.Request.Method + " " + c.Request.URL.Path
+		attempts[key]++
+		attempt := attempts[key]
+		attemptsLock.Unlock()
+
+		if attempt > count {
+			return
+		}
+		if status == 429 {
+			c.Header("Retry-After", "1")
+		}
+		c.AbortWithStatusJSON(status, gin.H{"error": fmt.Sprintf("transient failure %d", attempt)})
 	})
 
 	requireMachine := func(c *gin.Context) {
@@ -22,14 +55,60 @@ func Server(appName string) *httptest.Server {
 		}
 	}
 
-	api := srv.Group("/v1/apps/" + appName)
+	// Machine "leased" is always locked, others only validate the nonce if provided
+	requireLease := func(c *gin.Context) {
+		nonce := c.GetHeader("fly-machine-lease-nonce")
+		if (c.Param("id") == "leased" && nonce == "") || (nonce != "" && nonce != "1234") {
+			c.AbortWithStatusJSON(409, gin.H{"error": "lease currently held by owner@corp.com"})
+		}
+	}
+
+	apps := newAppStore(appNames)
+
+	metadata := map[string]string{"tenant": "acme"}
+	metadataLock := sync.Mutex{}
+
+	volumes := newVolumeStore()
+	secrets := newSecretStore()
+	network := newNetworkStore()
+
+	cordoned := map[string]bool{}
+	cordonedLock := sync.Mutex{}
+
+	api := srv.Group("/v1/apps/:app", apps.requireApp)
 	{
-		api.POST("/machines/:id/lease", requireMachine, func(c *gin.Context) {
+		api.POST("/machines/:id/lease", requireMachine, requireLease, func(c *gin.Context) {
 			c.String(200, fixture("create_lease"))
 		})
 
+		api.DELETE("/machines/:id/lease", requireMachine, requireLease, func(c *gin.Context) {
+			c.JSON(200, gin.H{"ok": true})
+		})
+
 		api.GET("/machines", func(c *gin.Context) {
-			c.String(200, fixture("list"))
+			list := []machines.Machine{}
+			if err := json.Unmarshal([]byte(fixture("list")), &list); err != nil {
+				panic(err)
+			}
+
+			// Destroyed machines are only listed when requested
+			if c.Query("include_deleted") == "true" {
+				destroyed := list[0]
+				destroyed.ID = "destroyed-1"
+				destroyed.State = machines.StateDestroyed
+				list = append(list, destroyed)
+			}
+
+			// Only region filter is applied on the server
+			result := []machines.Machine{}
+			for _, m := range list {
+				if region := c.Query("region"); region != "" && m.Region != region {
+					continue
+				}
+				result = append(result, m)
+			}
+
+			c.JSON(200, result)
 		})
 
 		api.GET("/machines/:id", requireMachine, func(c *gin.Context) {
@@ -53,27 +132,197 @@ func Server(appName string) *httptest.Server {
 			case "timeout": // simulate increased latency
 				time.Sleep(time.Second)
 			}
+
+			machine := machines.Machine{}
+			if err := json.Unmarshal([]byte(fixture("get")), &machine); err != nil {
+				panic(err)
+			}
+			if err := volumes.attach(c.Param("app"), machine.ID, input.Config.Mounts); err != nil {
+				c.AbortWithStatusJSON(400, gin.H{"error": err.Error()})
+				return
+			}
+			c.String(200, fixture("get"))
+		})
+
+		api.POST("/machines/:id", requireMachine, requireLease, func(c *gin.Context) {
+			input := machines.UpdateInput{}
+			if err := c.BindJSON(&input); err != nil {
+				panic(err)
+			}
+			if input.Config == nil {
+				c.AbortWithStatusJSON(400, gin.H{"error": "no config provided"})
+				return
+			}
+			if input.CurrentVersion != "" && input.CurrentVersion != "01GW3R0N8WCJN9QCQTN3RFEA3N" {
+				c.AbortWithStatusJSON(412, gin.H{"error": "machine version mismatch"})
+				return
+			}
 			c.String(200, fixture("get"))
 		})
 
+		// Scripted commands: "echo" prints arguments, "cat" prints stdin, "false" fails
+		api.POST("/machines/:id/exec", requireMachine, func(c *gin.Context) {
+			input := struct {
+				Command []string `json:"command"`
+				Stdin   string   `json:"stdin"`
+				Timeout int      `json:"timeout"`
+			}{}
+			if err := c.BindJSON(&input); err != nil {
+				panic(err)
+			}
+
+			switch input.Command[0] {
+			case "echo":
+				c.JSON(200, gin.H{"exit_code": 0, "stdout": strings.Join(input.Command[1:], " ") + "\n"})
+			case "cat":
+				c.JSON(200, gin.H{"exit_code": 0, "stdout": input.Stdin})
+			case "false":
+				c.JSON(200, gin.H{"exit_code": 1, "stderr": "command failed\n"})
+			default:
+				c.JSON(200, gin.H{"exit_code": 127, "stderr": input.Command[0] + ": command not found\n"})
+			}
+		})
+
+		api.GET("/machines/:id/events", requireMachine, func(c *gin.Context) {
+			c.String(200, fixture("events"))
+		})
+
+		api.GET("/machines/:id/metadata", requireMachine, func(c *gin.Context) {
+			metadataLock.Lock()
+			defer metadataLock.Unlock()
+
+			c.JSON(200, metadata)
+		})
+
+		api.POST("/machines/:id/metadata/:key", requireMachine, requireLease, func(c *gin.Context) {
+			input := map[string]string{}
+			if err := c.BindJSON(&input); err != nil {
+				panic(err)
+			}
+
+			metadataLock.Lock()
+			defer metadataLock.Unlock()
+
+			metadata[c.Param("key")] = input["value"]
+			c.Status(204)
+		})
+
+		api.DELETE("/machines/:id/metadata/:key", requireMachine, requireLease, func(c *gin.Context) {
+			metadataLock.Lock()
+			defer metadataLock.Unlock()
+
+			if _, ok := metadata[c.Param("key")]; !ok {
+				c.AbortWithStatusJSON(404, gin.H{"error": "metadata key not found"})
+				return
+			}
+			delete(metadata, c.Param("key"))
+			c.Status(204)
+		})
+
 		api.GET("/machines/:id/wait", requireMachine, func(c *gin.Context) {
 			c.JSON(200, gin.H{"ok": true})
 		})
 
-		api.POST("/machines/:id/stop", requireMachine, func(c *gin.Context) {
+		api.POST("/machines/:id/stop", requireMachine, requireLease, func(c *gin.Context) {
+			input := map[string]any{}
+			if err := c.BindJSON(&input); err != nil {
+				panic(err)
+			}
+			if _, ok := input["id"]; ok {
+				c.AbortWithStatusJSON(400, gin.H{"error": "unexpected id"})
+				return
+			}
+			if signal, ok := input["signal"]; ok {
+				if val, _ := signal.(string); !strings.HasPrefix(val, "SIG") {
+					c.AbortWithStatusJSON(400, gin.H{"error": "invalid signal"})
+					return
+				}
+			}
+			if timeout, ok := input["timeout"]; ok {
+				val, _ := timeout.(string)
+				if _, err := time.ParseDuration(val); err != nil {
+					c.AbortWithStatusJSON(400, gin.H{"error": "invalid timeout"})
+					return
+				}
+			}
 			c.JSON(200, gin.H{"ok": true})
 		})
 
-		api.DELETE("/machines/:id", requireMachine, func(c *gin.Context) {
+		api.POST("/machines/:id/start", requireMachine, requireLease, func(c *gin.Context) {
+			c.String(200, fixture("start"))
+		})
+
+		api.POST("/machines/:id/restart", requireMachine, requireLease, func(c *gin.Context) {
 			c.JSON(200, gin.H{"ok": true})
 		})
+
+		api.POST("/machines/:id/signal", requireMachine, requireLease, func(c *gin.Context) {
+			input := map[string]string{}
+			if err := c.BindJSON(&input); err != nil {
+				panic(err)
+			}
+			if !strings.HasPrefix(input["signal"], "SIG") {
+				c.AbortWithStatusJSON(400, gin.H{"error": "invalid signal"})
+				return
+			}
+			c.JSON(200, gin.H{"ok": true})
+		})
+
+		api.POST("/machines/:id/cordon", requireMachine, requireLease, func(c *gin.Context) {
+			cordonedLock.Lock()
+			defer cordonedLock.Unlock()
+
+			cordoned[c.Param("id")] = true
+			c.JSON(200, gin.H{"ok": true})
+		})
+
+		api.POST("/machines/:id/uncordon", requireMachine, requireLease, func(c *gin.Context) {
+			cordonedLock.Lock()
+			defer cordonedLock.Unlock()
+
+			if !cordoned[c.Param("id")] {
+				c.AbortWithStatusJSON(400, gin.H{"error": "machine is not cordoned"})
+				return
+			}
+			delete(cordoned, c.Param("id"))
+			c.JSON(200, gin.H{"ok": true})
+		})
+
+		api.POST("/machines/:id/suspend", requireMachine, requireLease, func(c *gin.Context) {
+			c.JSON(200, gin.H{"ok": true})
+		})
+
+		api.DELETE("/machines/:id", requireMachine, requireLease, func(c *gin.Context) {
+			if c.Param("id") == "running" && c.Query("force") != "true" {
+				c.AbortWithStatusJSON(412, gin.H{"error": "machine still active, refusing to delete"})
+				return
+			}
+			c.JSON(200, gin.H{"ok": true})
+		})
+
+		volumes.routes(api)
+		secrets.routes(api)
+		network.routes(api)
+		apps.routes(srv, api)
 	}
 
 	return httptest.NewServer(srv.Handler())
 }
 
+func machineIDFromPath(path string) string {
+	_, rest, found := strings.Cut(path, "/machines/")
+	if !found {
+		return ""
+	}
+	id, _, _ := strings.Cut(rest, "/")
+	return id
+}
+
+//go:embed *.json
+var fixtures embed.FS
+
 func fixture(path string) string {
-	data, err := os.ReadFile(filepath.Join("testdata", path+".json"))
+	data, err := fixtures.ReadFile(path + ".json")
 	if err != nil {
 		panic(err)
 	}
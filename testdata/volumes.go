@@ -0,0 +1,175 @@
+package testdata
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	machines "github.com/sosedoff/fly-machines"
+)
+
+// volumeStore keeps track of volumes created via the fake API for each app
+type volumeStore struct {
+	volumes map[string]map[string]*machines.Volume
+	lastID  int
+	sync.Mutex
+}
+
+func newVolumeStore() *volumeStore {
+	return &volumeStore{volumes: map[string]map[string]*machines.Volume{}}
+}
+
+func (s *volumeStore) create(app string, name string, region string, size int) *machines.Volume {
+	s.lastID++
+
+	vol := &machines.Volume{
+		ID:        fmt.Sprintf("vol_%d", s.lastID),
+		Name:      name,
+		Region:    region,
+		SizeGB:    size,
+		State:     machines.VolumeStateCreated,
+		Zone:      "a1b2",
+		FSType:    "ext4",
+		Encrypted: true,
+		CreatedAt: "2023-03-22T04:07:43Z",
+	}
+	if s.volumes[app] == nil {
+		s.volumes[app] = map[string]*machines.Volume{}
+	}
+	s.volumes[app][vol.ID] = vol
+
+	return vol
+}
+
+// attach marks app volumes as used by the machine, all of them must be available
+func (s *volumeStore) attach(app string, machineID string, mounts []machines.MountConfig) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, mount := range mounts {
+		vol, ok := s.volumes[app][mount.VolumeID]
+		if !ok {
+			return fmt.Errorf("volume %s not found", mount.VolumeID)
+		}
+		if vol.Attached() {
+			return fmt.Errorf("volume %s is already attached", mount.VolumeID)
+		}
+	}
+	for _, mount := range mounts {
+		s.volumes[app][mount.VolumeID].AttachedMachineID = machineID
+	}
+
+	return nil
+}
+
+func (s *volumeStore) routes(api *gin.RouterGroup) {
+	requireVolume := func(c *gin.Context) {
+		s.Lock()
+		defer s.Unlock()
+
+		if _, ok := s.volumes[c.Param("app")][c.Param("id")]; !ok {
+			c.AbortWithStatusJSON(404, gin.H{"error": "volume not found"})
+		}
+	}
+
+	api.GET("/volumes", func(c *gin.Context) {
+		s.Lock()
+		defer s.Unlock()
+
+		result := []machines.Volume{}
+		for i := 1; i <= s.lastID; i++ {
+			if vol, ok := s.volumes[c.Param("app")][fmt.Sprintf("vol_%d", i)]; ok {
+				result = append(result, *vol)
+			}
+		}
+		c.JSON(200, result)
+	})
+
+	api.POST("/volumes", func(c *gin.Context) {
+		input := struct {
+			machines.CreateVolumeInput
+			SourceVolumeID string `json:"source_volume_id"`
+		}{}
+		if err := c.BindJSON(&input); err != nil {
+			panic(err)
+		}
+
+		s.Lock()
+		defer s.Unlock()
+
+		if input.SourceVolumeID != "" {
+			source, ok := s.volumes[c.Param("app")][input.SourceVolumeID]
+			if !ok {
+				c.AbortWithStatusJSON(404, gin.H{"error": "source volume not found"})
+				return
+			}
+			if input.Name == "" {
+				input.Name = source.Name
+			}
+			if input.Region == "" {
+				input.Region = source.Region
+			}
+			c.JSON(200, s.create(c.Param("app"), input.Name, input.Region, source.SizeGB))
+			return
+		}
+
+		if err := input.Validate(); err != nil {
+			c.AbortWithStatusJSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, s.create(c.Param("app"), input.Name, input.Region, input.SizeGB))
+	})
+
+	api.GET("/volumes/:id", requireVolume, func(c *gin.Context) {
+		s.Lock()
+		defer s.Unlock()
+
+		c.JSON(200, s.volumes[c.Param("app")][c.Param("id")])
+	})
+
+	api.PUT("/volumes/:id/extend", requireVolume, func(c *gin.Context) {
+		input := machines.ExtendVolumeInput{}
+		if err := c.BindJSON(&input); err != nil {
+			panic(err)
+		}
+
+		s.Lock()
+		defer s.Unlock()
+
+		vol := s.volumes[c.Param("app")][c.Param("id")]
+		if input.SizeGB <= vol.SizeGB {
+			c.AbortWithStatusJSON(400, gin.H{"error": "volume size can only be increased"})
+			return
+		}
+		vol.SizeGB = input.SizeGB
+
+		c.JSON(200, machines.ExtendVolumeResult{Volume: *vol, NeedsRestart: vol.Attached()})
+	})
+
+	api.DELETE("/volumes/:id", requireVolume, func(c *gin.Context) {
+		s.Lock()
+		defer s.Unlock()
+
+		vol := s.volumes[c.Param("app")][c.Param("id")]
+		if vol.Attached() {
+			c.AbortWithStatusJSON(412, gin.H{"error": "volume is attached to a machine"})
+			return
+		}
+		delete(s.volumes[c.Param("app")], vol.ID)
+		vol.State = machines.VolumeStateDestroyed
+
+		c.JSON(200, vol)
+	})
+
+	api.GET("/volumes/:id/snapshots", requireVolume, func(c *gin.Context) {
+		c.JSON(200, []machines.VolumeSnapshot{
+			{
+				ID:        "vs_1",
+				Size:      1024,
+				Digest:    "sha256:8a1c5e2b",
+				Status:    "created",
+				CreatedAt: "2023-03-22T04:07:43Z",
+			},
+		})
+	})
+}
@@ -0,0 +1,104 @@
+// Package tracing creates OpenTelemetry spans for the machines client operations
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	machines "github.com/sosedoff/fly-machines"
+)
+
+const tracerName = "github.com/sosedoff/fly-machines/tracing"
+
+type spanKey struct{}
+
+// Middleware returns the client middleware that creates a span for every client
+// operation, e.g. "machines.CreateApp", and propagates the trace context to the
+// API with the global propagator. API calls made by the operation are recorded
+// as span events. Global tracer provider is used when provider is nil.
+//
+//	client := machines.NewClient("app", machines.WithMiddleware(tracing.Middleware(nil)))
+func Middleware(provider trace.TracerProvider) machines.Middleware {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	t := &tracer{
+		tracer:     provider.Tracer(tracerName, trace.WithInstrumentationVersion(machines.Version)),
+		propagator: otel.GetTextMapPropagator(),
+	}
+
+	return machines.Middleware{
+		StartOperation: t.startOperation,
+		EndOperation:   t.endOperation,
+		BeforeRequest:  t.beforeRequest,
+		Done:           t.done,
+	}
+}
+
+type tracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+func (t *tracer) startOperation(ctx context.Context, name string) context.Context {
+	ctx, span := t.tracer.Start(ctx, "machines."+name, trace.WithSpanKind(trace.SpanKindClient))
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+func (t *tracer) endOperation(ctx context.Context, name string, err error) {
+	span, ok := ctx.Value(spanKey{}).(trace.Span)
+	if !ok {
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (t *tracer) beforeRequest(call *machines.Call) error {
+	ctx := call.Request.Context()
+	if span, ok := ctx.Value(spanKey{}).(trace.Span); ok {
+		if call.AppName != "" {
+			span.SetAttributes(attribute.String("fly.app", call.AppName))
+		}
+		if call.MachineID != "" {
+			span.SetAttributes(attribute.String("fly.machine_id", call.MachineID))
+		}
+	}
+
+	t.propagator.Inject(ctx, propagation.HeaderCarrier(call.Request.Header))
+	return nil
+}
+
+func (t *tracer) done(call *machines.Call, err error) {
+	span, ok := call.Request.Context().Value(spanKey{}).(trace.Span)
+	if !ok {
+		return
+	}
+
+	attrs := []attribute.KeyValue{
+		attribute.String("http.request.method", call.Request.Method),
+		attribute.String("url.path", call.Request.URL.Path),
+	}
+	if call.StatusCode != 0 {
+		attrs = append(attrs, attribute.Int("http.response.status_code", call.StatusCode))
+		span.SetAttributes(attribute.Int("http.response.status_code", call.StatusCode))
+	}
+	if call.Attempts > 1 {
+		attrs = append(attrs, attribute.Int("http.request.resend_count", call.Attempts-1))
+	}
+	if call.Region != "" {
+		span.SetAttributes(attribute.String("fly.region", call.Region))
+	}
+	if err != nil {
+		attrs = append(attrs, attribute.String("error.message", err.Error()))
+	}
+	span.AddEvent(call.Operation, trace.WithAttributes(attrs...))
+}
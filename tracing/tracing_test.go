@@ -0,0 +1,100 @@
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	machines "github.com/sosedoff/fly-machines"
+	"github.com/sosedoff/fly-machines/testdata"
+	"github.com/sosedoff/fly-machines/tracing"
+)
+
+func TestMiddleware(t *testing.T) {
+	srv := testdata.Server("app", "other")
+	defer srv.Close()
+
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	var traceparent string
+	client := machines.NewClient("app",
+		machines.WithBaseURL(srv.URL),
+		machines.WithToken("api_token"),
+		machines.WithRetryPolicy(&machines.RetryPolicy{MaxAttempts: 3}),
+		machines.WithMiddleware(tracing.Middleware(provider)),
+		machines.WithMiddleware(machines.Middleware{
+			BeforeRequest: func(call *machines.Call) error {
+				traceparent = call.Request.Header.Get("traceparent")
+				return nil
+			},
+		}),
+	)
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "deploy")
+	_, err := client.GetContext(ctx, &machines.GetInput{ID: "1"})
+	require.NoError(t, err)
+	require.NoError(t, client.WaitContext(ctx, &machines.WaitInput{ID: "1", State: machines.StateStarted}))
+	_, err = client.GetContext(ctx, &machines.GetInput{ID: "foo"})
+	require.Error(t, err)
+	_, err = client.GetContext(ctx, &machines.GetInput{ID: "flaky-1-503"})
+	require.NoError(t, err)
+	_, err = client.CreateAppContext(ctx, &machines.CreateAppInput{Name: "customer-1", OrgSlug: "customers"})
+	require.NoError(t, err)
+	parent.End()
+
+	spans := recorder.Ended()
+	require.Equal(t, 7, len(spans))
+
+	attrs := func(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+		result := map[attribute.Key]attribute.Value{}
+		for _, attr := range span.Attributes() {
+			result[attr.Key] = attr.Value
+		}
+		return result
+	}
+
+	get := spans[0]
+	require.Equal(t, "machines.Get", get.Name())
+	require.Equal(t, parent.SpanContext().SpanID(), get.Parent().SpanID())
+	require.Equal(t, "app", attrs(get)["fly.app"].AsString())
+	require.Equal(t, "1", attrs(get)["fly.machine_id"].AsString())
+	require.Equal(t, "ord", attrs(get)["fly.region"].AsString())
+	require.Equal(t, int64(http.StatusOK), attrs(get)["http.response.status_code"].AsInt64())
+	require.Equal(t, 1, len(get.Events()))
+	require.Equal(t, "GET /apps/{app}/machines/{id}", get.Events()[0].Name)
+	require.Contains(t, traceparent, get.SpanContext().TraceID().String())
+
+	require.Equal(t, "machines.Wait", spans[1].Name())
+
+	require.Equal(t, codes.Error, spans[2].Status().Code)
+	require.Equal(t, int64(http.StatusNotFound), attrs(spans[2])["http.response.status_code"].AsInt64())
+
+	var resendCount int64
+	for _, attr := range spans[3].Events()[0].Attributes {
+		if attr.Key == "http.request.resend_count" {
+			resendCount = attr.Value.AsInt64()
+		}
+	}
+	require.Equal(t, int64(1), resendCount)
+
+	// Calls made by the operation are grouped under a single span
+	getApp, createApp := spans[4], spans[5]
+	require.Equal(t, "machines.CreateApp", createApp.Name())
+	require.Equal(t, parent.SpanContext().SpanID(), createApp.Parent().SpanID())
+	require.Equal(t, 1, len(createApp.Events()))
+	require.Equal(t, "POST /apps", createApp.Events()[0].Name)
+	require.Equal(t, "machines.GetApp", getApp.Name())
+	require.Equal(t, createApp.SpanContext().SpanID(), getApp.Parent().SpanID())
+}
@@ -1,5 +1,9 @@
 package machines
 
+import (
+	"fmt"
+)
+
 type Size string
 
 const (
@@ -30,11 +34,55 @@ const (
 	StateStarted    State = "started"
 	StateStopping   State = "stopping"
 	StateStopped    State = "stopped"
+	StateSuspending State = "suspending"
+	StateSuspended  State = "suspended"
 	StateReplacing  State = "replacing"
 	StateDestroying State = "destroying"
 	StateDestroyed  State = "destroyed"
 )
 
+// States lists all machine states
+var States = []State{
+	StateCreated,
+	StateStarting,
+	StateStarted,
+	StateStopping,
+	StateStopped,
+	StateSuspending,
+	StateSuspended,
+	StateReplacing,
+	StateDestroying,
+	StateDestroyed,
+}
+
+const (
+	SignalHUP  = 1
+	SignalINT  = 2
+	SignalQUIT = 3
+	SignalKILL = 9
+	SignalUSR1 = 10
+	SignalUSR2 = 12
+	SignalTERM = 15
+)
+
+var signalNames = map[int]string{
+	SignalHUP:  "SIGHUP",
+	SignalINT:  "SIGINT",
+	SignalQUIT: "SIGQUIT",
+	SignalKILL: "SIGKILL",
+	SignalUSR1: "SIGUSR1",
+	SignalUSR2: "SIGUSR2",
+	SignalTERM: "SIGTERM",
+}
+
+// signalName returns the signal name expected by the API, e.g. SIGTERM
+func signalName(sig int) string {
+	if name, ok := signalNames[sig]; ok {
+		return name
+	}
+	return fmt.Sprintf("%d", sig)
+}
+
 type RestartPolicy string
 
 const (
@@ -0,0 +1,66 @@
+package machines
+
+import (
+	"fmt"
+)
+
+type VolumeState string
+
+const (
+	VolumeStateCreated    VolumeState = "created"
+	VolumeStateHydrating  VolumeState = "hydrating"
+	VolumeStateExtending  VolumeState = "extending"
+	VolumeStateDestroying VolumeState = "destroying"
+	VolumeStateDestroyed  VolumeState = "destroyed"
+)
+
+type Volume struct {
+	ID                string      `json:"id"`
+	Name              string      `json:"name"`
+	State             VolumeState `json:"state"`
+	SizeGB            int         `json:"size_gb"`
+	Region            string      `json:"region"`
+	Zone              string      `json:"zone"`
+	Encrypted         bool        `json:"encrypted"`
+	FSType            string      `json:"fstype"`
+	AttachedMachineID string      `json:"attached_machine_id"`
+	AttachedAllocID   string      `json:"attached_alloc_id"`
+	SnapshotRetention int         `json:"snapshot_retention"`
+	CreatedAt         string      `json:"created_at"`
+}
+
+// Attached returns true if volume is mounted by a machine
+func (v Volume) Attached() bool {
+	return v.AttachedMachineID != ""
+}
+
+// MountConfig returns the machine mount config for the volume
+func (v Volume) MountConfig(path string) MountConfig {
+	return MountConfig{VolumeID: v.ID, Path: path}
+}
+
+func (v Volume) Inspect() string {
+	return fmt.Sprintf(
+		"volume(id=%q name=%q region=%q state=%q size_gb=%d attached_machine_id=%q)",
+		v.ID,
+		v.Name,
+		v.Region,
+		v.State,
+		v.SizeGB,
+		v.AttachedMachineID,
+	)
+}
+
+type VolumeSnapshot struct {
+	ID        string `json:"id"`
+	Size      int64  `json:"size"`
+	Digest    string `json:"digest"`
+	Status    string `json:"status"`
+	CreatedAt string `json:"created_at"`
+}
+
+// ExtendVolumeResult is returned by the volume extend call
+type ExtendVolumeResult struct {
+	Volume       Volume `json:"volume"`
+	NeedsRestart bool   `json:"needs_restart"`
+}
@@ -0,0 +1,118 @@
+package machines_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	machines "github.com/sosedoff/fly-machines"
+	"github.com/sosedoff/fly-machines/testdata"
+)
+
+func TestVolumes(t *testing.T) {
+	srv := testdata.Server("app", "other")
+	defer srv.Close()
+
+	client := testClient(srv.URL)
+	ctx := context.Background()
+
+	_, err := client.CreateVolumeContext(ctx, nil)
+	require.Equal(t, machines.ErrInputRequired, err)
+
+	_, err = client.CreateVolumeContext(ctx, &machines.CreateVolumeInput{})
+	require.Equal(t, machines.ErrVolumeNameRequired, err)
+
+	_, err = client.CreateVolumeContext(ctx, &machines.CreateVolumeInput{Name: "data"})
+	require.Equal(t, machines.ErrRegionRequired, err)
+
+	_, err = client.CreateVolumeContext(ctx, &machines.CreateVolumeInput{Name: "data", Region: "ord"})
+	require.Equal(t, machines.ErrVolumeSizeRequired, err)
+
+	_, err = client.GetVolumeContext(ctx, &machines.VolumeInput{})
+	require.Equal(t, machines.ErrVolumeIDRequired, err)
+
+	_, err = client.GetVolumeContext(ctx, &machines.VolumeInput{ID: "vol_foo"})
+	require.Equal(t, "volume not found", err.Error())
+
+	_, err = client.ExtendVolumeContext(ctx, &machines.ExtendVolumeInput{ID: "vol_1"})
+	require.Equal(t, machines.ErrVolumeSizeRequired, err)
+
+	_, err = client.ForkVolumeContext(ctx, &machines.ForkVolumeInput{})
+	require.Equal(t, machines.ErrVolumeIDRequired, err)
+
+	volume, err := client.CreateVolumeContext(ctx, &machines.CreateVolumeInput{Name: "data", Region: "ord", SizeGB: 1})
+	require.NoError(t, err)
+	require.Equal(t, "vol_1", volume.ID)
+	require.Equal(t, machines.VolumeStateCreated, volume.State)
+	require.False(t, volume.Attached())
+
+	fork, err := client.ForkVolumeContext(ctx, &machines.ForkVolumeInput{ID: volume.ID, Name: "data_copy"})
+	require.NoError(t, err)
+	require.Equal(t, "vol_2", fork.ID)
+	require.Equal(t, "ord", fork.Region)
+	require.Equal(t, 1, fork.SizeGB)
+
+	volumes, err := client.ListVolumesContext(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(volumes))
+	require.Equal(t, "data", volumes[0].Name)
+	require.Equal(t, "data_copy", volumes[1].Name)
+
+	snapshots, err := client.ListVolumeSnapshotsContext(ctx, &machines.VolumeInput{ID: volume.ID})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(snapshots))
+
+	// Mount the volume into a new machine
+	_, err = client.CreateContext(ctx, &machines.CreateInput{
+		Config: &machines.Config{Mounts: []machines.MountConfig{{VolumeID: "vol_foo", Path: "/data"}}},
+	})
+	require.Equal(t, "volume vol_foo not found", err.Error())
+
+	machine, err := client.CreateContext(ctx, &machines.CreateInput{
+		Config: &machines.Config{Mounts: []machines.MountConfig{volume.MountConfig("/data")}},
+	})
+	require.NoError(t, err)
+
+	volume, err = client.GetVolumeContext(ctx, &machines.VolumeInput{ID: volume.ID})
+	require.NoError(t, err)
+	require.Equal(t, machine.ID, volume.AttachedMachineID)
+
+	_, err = client.CreateContext(ctx, &machines.CreateInput{
+		Config: &machines.Config{Mounts: []machines.MountConfig{volume.MountConfig("/data")}},
+	})
+	require.Equal(t, "volume vol_1 is already attached", err.Error())
+
+	_, err = client.ExtendVolumeContext(ctx, &machines.ExtendVolumeInput{ID: volume.ID, SizeGB: 1})
+	require.Equal(t, "volume size can only be increased", err.Error())
+
+	result, err := client.ExtendVolumeContext(ctx, &machines.ExtendVolumeInput{ID: volume.ID, SizeGB: 10})
+	require.NoError(t, err)
+	require.Equal(t, 10, result.Volume.SizeGB)
+	require.True(t, result.NeedsRestart)
+
+	_, err = client.DeleteVolumeContext(ctx, &machines.VolumeInput{ID: volume.ID})
+	require.Equal(t, "volume is attached to a machine", err.Error())
+
+	deleted, err := client.DeleteVolumeContext(ctx, &machines.VolumeInput{ID: fork.ID})
+	require.NoError(t, err)
+	require.Equal(t, machines.VolumeStateDestroyed, deleted.State)
+
+	volumes, err = client.ListVolumesContext(ctx, &machines.ListVolumesInput{})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(volumes))
+
+	// Volumes are scoped to the app
+	volumes, err = client.ListVolumesContext(ctx, &machines.ListVolumesInput{AppName: "other"})
+	require.NoError(t, err)
+	require.Empty(t, volumes)
+
+	_, err = client.GetVolumeContext(ctx, &machines.VolumeInput{ID: volume.ID, AppName: "other"})
+	require.Equal(t, "volume not found", err.Error())
+
+	_, err = client.CreateContext(ctx, &machines.CreateInput{
+		AppName: "other",
+		Config:  &machines.Config{Mounts: []machines.MountConfig{volume.MountConfig("/data")}},
+	})
+	require.Equal(t, "volume vol_1 not found", err.Error())
+}